@@ -0,0 +1,123 @@
+package bdmv
+
+import (
+	"errors"
+	"github.com/mbiamont/go-pgs-parser/ts"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Bdmv interface {
+	// Playlists Parse every playlist of the PLAYLIST folder, sorted by name
+	Playlists() ([]Playlist, error)
+
+	// MainPlaylist Return the longest playlist, which is usually the main feature
+	MainPlaylist() (*Playlist, error)
+
+	// Clip Parse the clip information file of the CLIPINF folder with the given clip name, e.g. "00001"
+	Clip(clipName string) (*Clip, error)
+
+	// NewSupReader Read the PG stream with the given PID along the play items of the playlist as a single SUP stream.
+	// Only the display sets presented between the in and out times of each play item are kept, and their timestamps
+	// are shifted to follow each other. Subtitles still displayed at the in time are shown again from it, and subtitles
+	// still displayed at the out time are cleared at it
+	NewSupReader(playlist Playlist, pid int) io.ReadCloser
+}
+
+type bdmv struct {
+	folderPath string
+}
+
+// NewBdmv Initialize a new reader of the BDMV folder at the given path, which may also be the root folder of the disc
+func NewBdmv(folderPath string) Bdmv {
+	if _, err := os.Stat(filepath.Join(folderPath, "BDMV", "PLAYLIST")); err == nil {
+		folderPath = filepath.Join(folderPath, "BDMV")
+	}
+
+	return &bdmv{
+		folderPath: folderPath,
+	}
+}
+
+func (b *bdmv) Playlists() ([]Playlist, error) {
+	filePaths, err := filepath.Glob(filepath.Join(b.folderPath, "PLAYLIST", "*.mpls"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(filePaths)
+
+	var playlists []Playlist
+
+	for _, filePath := range filePaths {
+		data, err := os.ReadFile(filePath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		playlist, err := parseMpls(strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)), data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		playlists = append(playlists, *playlist)
+	}
+
+	return playlists, nil
+}
+
+func (b *bdmv) MainPlaylist() (*Playlist, error) {
+	playlists, err := b.Playlists()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(playlists) == 0 {
+		return nil, errors.New("no playlist found")
+	}
+
+	main := playlists[0]
+
+	for _, playlist := range playlists[1:] {
+		if playlist.Duration() > main.Duration() {
+			main = playlist
+		}
+	}
+
+	return &main, nil
+}
+
+func (b *bdmv) Clip(clipName string) (*Clip, error) {
+	data, err := os.ReadFile(filepath.Join(b.folderPath, "CLIPINF", clipName+".clpi"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClpi(clipName, data)
+}
+
+func (b *bdmv) NewSupReader(playlist Playlist, pid int) io.ReadCloser {
+	demuxer := newPlaylistDemuxer(b.folderPath, playlist)
+
+	return &supReadCloser{
+		Reader:  ts.NewSupReader(demuxer, pid),
+		demuxer: demuxer,
+	}
+}
+
+type supReadCloser struct {
+	io.Reader
+	demuxer *playlistDemuxer
+}
+
+func (s *supReadCloser) Close() error {
+	return s.demuxer.close()
+}
@@ -0,0 +1,121 @@
+package bdmv
+
+import (
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+)
+
+const clpiMagicNumber = "HDMV"
+
+// Clip M2TS file described by a clip information file
+type Clip struct {
+	Name      string
+	PgStreams []PgStream
+}
+
+// parseClpi Parse the PG streams of the program sequences of a clip information file
+func parseClpi(name string, data []byte) (*Clip, error) {
+	reader := buffer.NewBufferReader(buffer.NewUint8ArrayBuffer(data))
+
+	magicNumber, err := readString(reader, 4)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if magicNumber != clpiMagicNumber {
+		return nil, fmt.Errorf("%s is not a clip information file", name)
+	}
+
+	// Version and sequence info start address
+	_, err = reader.ReadBytes(8)
+
+	if err != nil {
+		return nil, err
+	}
+
+	programInfoStart, err := reader.ReadBytes(4)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = readerAt(data, programInfoStart)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Length and reserved byte
+	_, err = reader.ReadBytes(5)
+
+	if err != nil {
+		return nil, err
+	}
+
+	programSequenceCount, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clip := &Clip{
+		Name: name,
+	}
+
+	pids := map[int]bool{}
+
+	for i := 0; i < programSequenceCount; i++ {
+		// Source packet number and program map PID
+		_, err = reader.ReadBytes(6)
+
+		if err != nil {
+			return nil, err
+		}
+
+		streamCount, err := reader.ReadBytes(1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Group count
+		_, err = reader.ReadBytes(1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for j := 0; j < streamCount; j++ {
+			pid, err := reader.ReadBytes(2)
+
+			if err != nil {
+				return nil, err
+			}
+
+			codingInfoLength, err := reader.ReadBytes(1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			codingInfo, err := reader.ReadByteSlice(codingInfoLength)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if len(codingInfo) < 4 || codingInfo[0] != pgCodingType || pids[pid] {
+				continue
+			}
+
+			pids[pid] = true
+			clip.PgStreams = append(clip.PgStreams, PgStream{
+				Pid:      pid,
+				Language: string(codingInfo[1:4]),
+			})
+		}
+	}
+
+	return clip, nil
+}
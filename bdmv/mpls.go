@@ -0,0 +1,372 @@
+package bdmv
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"time"
+)
+
+// clockRate Playlist times are expressed in 45kHz units
+const clockRate = 45000
+
+const (
+	mplsMagicNumber = "MPLS"
+	pgCodingType    = 0x90
+)
+
+// Playlist Sequence of clip parts played one after the other
+type Playlist struct {
+	Name      string
+	PlayItems []PlayItem
+	PgStreams []PgStream
+}
+
+// PlayItem Part of a clip played by a playlist, in and out times being in the clip timeline
+type PlayItem struct {
+	ClipName string
+	InTime   time.Duration
+	OutTime  time.Duration
+
+	// inTime Start of the part in 45kHz units
+	inTime int64
+
+	// outTime End of the part in 45kHz units
+	outTime int64
+}
+
+// PgStream Presentation graphics stream, i.e. a PGS subtitle track
+type PgStream struct {
+	Pid      int
+	Language string
+}
+
+// Duration Sum of the durations of the play items
+func (p Playlist) Duration() time.Duration {
+	duration := time.Duration(0)
+
+	for _, playItem := range p.PlayItems {
+		duration += playItem.OutTime - playItem.InTime
+	}
+
+	return duration
+}
+
+// parseMpls Parse the play items and the PG streams of the first play item of a movie playlist file
+func parseMpls(name string, data []byte) (*Playlist, error) {
+	reader := buffer.NewBufferReader(buffer.NewUint8ArrayBuffer(data))
+
+	magicNumber, err := readString(reader, 4)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if magicNumber != mplsMagicNumber {
+		return nil, fmt.Errorf("%s is not a playlist file", name)
+	}
+
+	// Version
+	_, err = reader.ReadBytes(4)
+
+	if err != nil {
+		return nil, err
+	}
+
+	playlistStart, err := reader.ReadBytes(4)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = readerAt(data, playlistStart)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Length and reserved bytes
+	_, err = reader.ReadBytes(6)
+
+	if err != nil {
+		return nil, err
+	}
+
+	playItemCount, err := reader.ReadBytes(2)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Sub path count
+	_, err = reader.ReadBytes(2)
+
+	if err != nil {
+		return nil, err
+	}
+
+	playlist := &Playlist{
+		Name: name,
+	}
+
+	for i := 0; i < playItemCount; i++ {
+		length, err := reader.ReadBytes(2)
+
+		if err != nil {
+			return nil, err
+		}
+
+		playItemStart := reader.Index()
+
+		playItem, pgStreams, err := parsePlayItem(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		playlist.PlayItems = append(playlist.PlayItems, *playItem)
+
+		if i == 0 {
+			playlist.PgStreams = pgStreams
+		}
+
+		remaining := playItemStart + length - reader.Index()
+
+		if remaining < 0 {
+			return nil, fmt.Errorf("play item %d of %s is longer than its length %d", i, name, length)
+		}
+
+		// Skip what's left of the play item
+		_, err = reader.ReadBytes(remaining)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return playlist, nil
+}
+
+func parsePlayItem(reader buffer.BufferReader) (*PlayItem, []PgStream, error) {
+	clipName, err := readString(reader, 5)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Codec identifier
+	_, err = reader.ReadBytes(4)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flags, err := reader.ReadBytes(2)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	multiAngle := flags&0x10 != 0
+
+	// STC id
+	_, err = reader.ReadBytes(1)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inTime, err := reader.ReadBytes(4)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outTime, err := reader.ReadBytes(4)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// UO mask table, random access flag, still mode and still time
+	_, err = reader.ReadBytes(12)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if multiAngle {
+		err = skipAngles(reader)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	pgStreams, err := parseStnTable(reader)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &PlayItem{
+		ClipName: clipName,
+		InTime:   toDuration(int64(inTime)),
+		OutTime:  toDuration(int64(outTime)),
+		inTime:   int64(inTime),
+		outTime:  int64(outTime),
+	}, pgStreams, nil
+}
+
+// skipAngles Skip the clips of the other angles of a multi-angle play item
+func skipAngles(reader buffer.BufferReader) error {
+	angleCount, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return err
+	}
+
+	if angleCount < 1 {
+		return fmt.Errorf("invalid angle count %d", angleCount)
+	}
+
+	// Flags, then the clip name, codec identifier and STC id of each angle but the first one
+	_, err = reader.ReadBytes(1 + (angleCount-1)*10)
+
+	return err
+}
+
+// parseStnTable Parse the PG streams of a stream number table, the video and audio streams coming before them being skipped
+func parseStnTable(reader buffer.BufferReader) ([]PgStream, error) {
+	// Length and reserved bytes
+	_, err := reader.ReadBytes(4)
+
+	if err != nil {
+		return nil, err
+	}
+
+	videoCount, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	audioCount, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pgCount, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Interactive graphics, secondary audio and secondary video counts
+	_, err = reader.ReadBytes(3)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pipPgCount, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Reserved bytes
+	_, err = reader.ReadBytes(5)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < videoCount+audioCount; i++ {
+		_, _, err = parseStream(reader)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var pgStreams []PgStream
+
+	for i := 0; i < pgCount+pipPgCount; i++ {
+		pid, attributes, err := parseStream(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(attributes) < 4 || attributes[0] != pgCodingType {
+			// Text subtitles
+			continue
+		}
+
+		pgStreams = append(pgStreams, PgStream{
+			Pid:      pid,
+			Language: string(attributes[1:4]),
+		})
+	}
+
+	return pgStreams, nil
+}
+
+// parseStream Parse the PID and the attributes of a stream entry
+func parseStream(reader buffer.BufferReader) (int, []byte, error) {
+	entryLength, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	entry, err := reader.ReadByteSlice(entryLength)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(entry) < 3 {
+		return 0, nil, errors.New("stream entry is too short")
+	}
+
+	// Streams of the main clip are referenced by their PID, streams of sub paths by their sub path and sub clip ids first
+	pid := int(entry[1])<<8 | int(entry[2])
+
+	if entry[0] == 2 && len(entry) >= 5 {
+		pid = int(entry[3])<<8 | int(entry[4])
+	} else if entry[0] != 1 && len(entry) >= 4 {
+		pid = int(entry[2])<<8 | int(entry[3])
+	}
+
+	attributesLength, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	attributes, err := reader.ReadByteSlice(attributesLength)
+
+	return pid, attributes, err
+}
+
+func toDuration(time45kHz int64) time.Duration {
+	return time.Duration(time45kHz) * time.Second / clockRate
+}
+
+// readerAt Reader starting at the given offset of the data
+func readerAt(data []byte, offset int) (buffer.BufferReader, error) {
+	if offset > len(data) {
+		return nil, fmt.Errorf("offset %d is out of bounds", offset)
+	}
+
+	return buffer.NewBufferReader(buffer.NewUint8ArrayBuffer(data[offset:])), nil
+}
+
+func readString(reader buffer.BufferReader, count int) (string, error) {
+	data, err := reader.ReadByteSlice(count)
+
+	return string(data), err
+}
@@ -0,0 +1,511 @@
+package bdmv
+
+import (
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"github.com/mbiamont/go-pgs-parser/ts"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// playlistDemuxer Demuxes the M2TS files of the play items of a playlist one after the other, keeping the display sets
+// presented between the in and out times of each play item and shifting their timestamps onto the playlist timeline
+type playlistDemuxer struct {
+	folderPath string
+	playlist   Playlist
+	playItem   int
+	file       *os.File
+	demuxer    ts.Demuxer
+	// offset Start of the current play item on the playlist timeline, in 90kHz units
+	offset     int64
+	current    []ts.Pes
+	pendingPes []ts.Pes
+
+	// segmentMapper and parser Decode the segments of the display sets
+	segmentMapper segment.SegmentMapper
+	parser        displaySet.DisplaySetParser
+
+	// epoch Display sets of the current epoch presented before the in time of the play item
+	epoch [][]ts.Pes
+	// started Whether the display sets presented from the in time of the play item are being queued
+	started bool
+	// ended Whether the out time of the play item was reached
+	ended bool
+	// shown Last display set queued if it shows objects, which must be cleared at the out time
+	shown []ts.Pes
+}
+
+func newPlaylistDemuxer(folderPath string, playlist Playlist) *playlistDemuxer {
+	return &playlistDemuxer{
+		folderPath:    folderPath,
+		playlist:      playlist,
+		segmentMapper: segment.NewSegmentMapper(),
+		parser:        displaySet.NewDisplaySetParser(),
+	}
+}
+
+func (p *playlistDemuxer) Streams() ([]ts.Stream, error) {
+	var streams []ts.Stream
+
+	for _, pgStream := range p.playlist.PgStreams {
+		streams = append(streams, ts.Stream{
+			Pid:        pgStream.Pid,
+			StreamType: ts.PgsStreamType,
+			Language:   pgStream.Language,
+		})
+	}
+
+	return streams, nil
+}
+
+func (p *playlistDemuxer) NextPes(pid int) (*ts.Pes, error) {
+	for len(p.pendingPes) == 0 {
+		err := p.readPes(pid)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pes := p.pendingPes[0]
+	p.pendingPes = p.pendingPes[1:]
+
+	return &pes, nil
+}
+
+// readPes Read the next PES packet of the current play item, queueing its display set once complete
+func (p *playlistDemuxer) readPes(pid int) error {
+	if p.demuxer == nil {
+		if p.playItem >= len(p.playlist.PlayItems) {
+			return io.EOF
+		}
+
+		err := p.open(p.playlist.PlayItems[p.playItem])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	pes, err := p.demuxer.NextPes(pid)
+
+	if err == io.EOF {
+		playItem := p.playlist.PlayItems[p.playItem]
+		p.end(playItem, nil)
+		p.offset += 2 * (playItem.outTime - playItem.inTime)
+		p.playItem++
+		p.current = nil
+
+		return p.close()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(pes.Data) > 0 && pes.Data[0] == p.segmentMapper.FromSegmentType(segment.SegmentTypePcs) {
+		p.current = []ts.Pes{*pes}
+	} else if p.current != nil {
+		p.current = append(p.current, *pes)
+	}
+
+	if p.current != nil && p.hasSegment(pes.Data, segment.SegmentTypeEnd) {
+		p.queueDisplaySet()
+	}
+
+	return nil
+}
+
+// queueDisplaySet Queue the PES packets of the display set if it's presented during the play item
+func (p *playlistDemuxer) queueDisplaySet() {
+	playItem := p.playlist.PlayItems[p.playItem]
+	set := p.current
+	presentationTimestamp := set[0].PresentationTimestamp
+	p.current = nil
+
+	if p.ended {
+		return
+	}
+
+	if presentationTimestamp < 2*playItem.inTime {
+		// Kept in case it's still displayed at the in time, or defines objects displayed after it
+		if p.compositionState(set) != segment.CompositionStateNormal {
+			p.epoch = nil
+		}
+
+		p.epoch = append(p.epoch, set)
+		return
+	}
+
+	p.start(playItem, set)
+
+	if presentationTimestamp >= 2*playItem.outTime {
+		p.end(playItem, set)
+		return
+	}
+
+	p.queue(playItem, set)
+}
+
+// start Queue the state of the epoch at the in time of the play item, when it's still displayed or the next display set
+// relies on it
+func (p *playlistDemuxer) start(playItem PlayItem, next []ts.Pes) {
+	if p.started {
+		return
+	}
+
+	epoch := p.epoch
+	p.started = true
+	p.epoch = nil
+
+	if len(epoch) == 0 {
+		return
+	}
+
+	shown := p.objectCount(epoch[len(epoch)-1]) > 0
+
+	if shown || (next != nil && p.compositionState(next) == segment.CompositionStateNormal) {
+		p.queue(playItem, p.mergeEpoch(epoch, 2*playItem.inTime))
+	}
+}
+
+// end Clear what's displayed at the out time of the play item, with the first display set presented after it if it
+// clears the screen and with a new display set otherwise
+func (p *playlistDemuxer) end(playItem PlayItem, next []ts.Pes) {
+	if p.ended {
+		return
+	}
+
+	p.start(playItem, nil)
+	p.ended = true
+
+	if p.shown == nil {
+		return
+	}
+
+	clear := next
+
+	if clear == nil || p.objectCount(clear) > 0 {
+		clear = p.clearingDisplaySet(p.shown)
+	}
+
+	for i := range clear {
+		clear[i].PresentationTimestamp = 2 * playItem.outTime
+
+		if clear[i].DecodingTimestamp != 0 {
+			clear[i].DecodingTimestamp = 2 * playItem.outTime
+		}
+	}
+
+	p.queue(playItem, clear)
+}
+
+// queue Queue the PES packets of the display set, moved onto the playlist timeline
+func (p *playlistDemuxer) queue(playItem PlayItem, set []ts.Pes) {
+	for _, pes := range set {
+		pes.PresentationTimestamp = p.retime(pes.PresentationTimestamp, playItem)
+
+		if pes.DecodingTimestamp != 0 {
+			pes.DecodingTimestamp = p.retime(pes.DecodingTimestamp, playItem)
+		}
+
+		p.pendingPes = append(p.pendingPes, pes)
+	}
+
+	p.shown = nil
+
+	if p.objectCount(set) > 0 {
+		p.shown = set
+	}
+}
+
+// retime Move a timestamp of the clip timeline onto the playlist timeline
+func (p *playlistDemuxer) retime(timestamp int64, playItem PlayItem) int64 {
+	retimed := timestamp - 2*playItem.inTime + p.offset
+
+	if retimed < 0 {
+		// Segments decoded before the in time of the play item
+		return 0
+	}
+
+	return retimed
+}
+
+func (p *playlistDemuxer) open(playItem PlayItem) error {
+	file, err := os.Open(filepath.Join(p.folderPath, "STREAM", playItem.ClipName+".m2ts"))
+
+	if err != nil {
+		return err
+	}
+
+	p.file = file
+	p.demuxer = ts.NewDemuxer(file)
+	p.epoch = nil
+	p.started = false
+	p.ended = false
+
+	return nil
+}
+
+func (p *playlistDemuxer) close() error {
+	if p.file == nil {
+		return nil
+	}
+
+	err := p.file.Close()
+	p.file = nil
+	p.demuxer = nil
+
+	return err
+}
+
+// pesSegment Segment of a PES packet
+type pesSegment struct {
+	segmentType segment.SegmentType
+	payload     []byte
+}
+
+// segments Split the PES packets of a display set into segments, ignoring truncated ones and unknown segment types
+func (p *playlistDemuxer) segments(set []ts.Pes) []pesSegment {
+	var segments []pesSegment
+
+	for _, pes := range set {
+		data := pes.Data
+
+		for len(data) >= 3 {
+			size := 3 + (int(data[1])<<8 | int(data[2]))
+
+			if size > len(data) {
+				break
+			}
+
+			segmentType, err := p.segmentMapper.ToSegmentType(data[0])
+
+			if err == nil {
+				segments = append(segments, pesSegment{
+					segmentType: segmentType,
+					payload:     data[3:size],
+				})
+			}
+
+			data = data[size:]
+		}
+	}
+
+	return segments
+}
+
+// toPes Put each segment in its own PES packet
+func (p *playlistDemuxer) toPes(pid int, presentationTimestamp int64, segments []pesSegment) []ts.Pes {
+	var set []ts.Pes
+
+	for _, pesSegment := range segments {
+		data := []byte{p.segmentMapper.FromSegmentType(pesSegment.segmentType), byte(len(pesSegment.payload) >> 8), byte(len(pesSegment.payload))}
+
+		set = append(set, ts.Pes{
+			Pid:                   pid,
+			PresentationTimestamp: presentationTimestamp,
+			Data:                  append(data, pesSegment.payload...),
+		})
+	}
+
+	return set
+}
+
+// parseSegment Reader and header to parse the payload of a segment with the display set parser
+func (p *playlistDemuxer) parseSegment(pesSegment pesSegment) (buffer.BufferReader, segment.SegmentHeader) {
+	return buffer.NewBufferReader(buffer.NewUint8ArrayBuffer(pesSegment.payload)), segment.SegmentHeader{
+		SegmentType: pesSegment.segmentType,
+		SegmentSize: len(pesSegment.payload),
+	}
+}
+
+// pcs PCS starting the display set, nil if it's missing or invalid
+func (p *playlistDemuxer) pcs(set []ts.Pes) *segment.PresentationCompositionSegment {
+	if len(set) == 0 {
+		return nil
+	}
+
+	segments := p.segments(set[:1])
+
+	if len(segments) == 0 || segments[0].segmentType != segment.SegmentTypePcs {
+		return nil
+	}
+
+	pcs, err := p.parser.ParsePcsSegment(p.parseSegment(segments[0]))
+
+	if err != nil {
+		return nil
+	}
+
+	return pcs
+}
+
+func (p *playlistDemuxer) compositionState(set []ts.Pes) segment.CompositionState {
+	pcs := p.pcs(set)
+
+	if pcs == nil {
+		return segment.CompositionStateNormal
+	}
+
+	return pcs.CompositionState
+}
+
+func (p *playlistDemuxer) objectCount(set []ts.Pes) int {
+	pcs := p.pcs(set)
+
+	if pcs == nil {
+		return 0
+	}
+
+	return len(pcs.CompositionObjects)
+}
+
+// pcsSegment Encode the PCS as a segment
+func (p *playlistDemuxer) pcsSegment(pcs segment.PresentationCompositionSegment) pesSegment {
+	payload := buffer.NewBufferWriter()
+
+	payload.WriteBytes(pcs.Width, 2)
+	payload.WriteBytes(pcs.Height, 2)
+	payload.WriteBytes(pcs.FrameRate, 1)
+	payload.WriteBytes(pcs.CompositionNumber, 2)
+	payload.WriteBytes(int(p.segmentMapper.FromCompositionState(pcs.CompositionState)), 1)
+	payload.WriteBytes(int(p.segmentMapper.FromPaletteUpdateFlag(pcs.PaletteUpdateFlag)), 1)
+	payload.WriteBytes(pcs.PaletteId, 1)
+	payload.WriteBytes(len(pcs.CompositionObjects), 1)
+
+	for _, compositionObject := range pcs.CompositionObjects {
+		payload.WriteBytes(compositionObject.ObjectId, 2)
+		payload.WriteBytes(compositionObject.WindowId, 1)
+		payload.WriteBytes(int(p.segmentMapper.FromObjectFlags(compositionObject.ObjectCroppedFlag, compositionObject.ObjectForcedOnFlag)), 1)
+		payload.WriteBytes(compositionObject.ObjectHorizontalPosition, 2)
+		payload.WriteBytes(compositionObject.ObjectVerticalPosition, 2)
+
+		if compositionObject.ObjectCroppedFlag {
+			payload.WriteBytes(compositionObject.ObjectCroppingHorizontalPosition, 2)
+			payload.WriteBytes(compositionObject.ObjectCroppingVerticalPosition, 2)
+			payload.WriteBytes(compositionObject.ObjectCroppingWidth, 2)
+			payload.WriteBytes(compositionObject.ObjectCroppingHeight, 2)
+		}
+	}
+
+	return pesSegment{
+		segmentType: segment.SegmentTypePcs,
+		payload:     payload.Bytes(),
+	}
+}
+
+// mergeEpoch Merge the display sets of an epoch into an epoch start presented at the given time, which defines the last
+// windows, palettes and objects they define and shows what the last one shows
+func (p *playlistDemuxer) mergeEpoch(epoch [][]ts.Pes, presentationTimestamp int64) []ts.Pes {
+	var windows *pesSegment
+	var palettes []pesSegment
+	var objects [][]pesSegment
+	paletteIndices := map[int]int{}
+	objectIndices := map[int]int{}
+
+	for _, set := range epoch {
+		for _, pesSegment := range p.segments(set) {
+			switch pesSegment.segmentType {
+			case segment.SegmentTypeWds:
+				wds := pesSegment
+				windows = &wds
+			case segment.SegmentTypePds:
+				pds, err := p.parser.ParsePdsSegment(p.parseSegment(pesSegment))
+
+				if err != nil {
+					continue
+				}
+
+				if i, ok := paletteIndices[pds.PaletteId]; ok {
+					palettes[i] = pesSegment
+				} else {
+					paletteIndices[pds.PaletteId] = len(palettes)
+					palettes = append(palettes, pesSegment)
+				}
+			case segment.SegmentTypeOds:
+				ods, err := p.parser.ParseOdsSegment(p.parseSegment(pesSegment))
+
+				if err != nil {
+					continue
+				}
+
+				i, ok := objectIndices[ods.ObjectId]
+
+				if !ok {
+					i = len(objects)
+					objectIndices[ods.ObjectId] = i
+					objects = append(objects, nil)
+				}
+
+				if ods.LastInSequenceFlag == segment.LastInSequenceFlagFirstInSequence || ods.LastInSequenceFlag == segment.LastInSequenceFlagFirstAndLastInSequence {
+					objects[i] = nil
+				}
+
+				objects[i] = append(objects[i], pesSegment)
+			}
+		}
+	}
+
+	pcs := p.pcs(epoch[len(epoch)-1])
+
+	if pcs == nil {
+		return nil
+	}
+
+	pcs.CompositionState = segment.CompositionStateEpochStart
+	pcs.PaletteUpdateFlag = false
+
+	merged := []pesSegment{p.pcsSegment(*pcs)}
+
+	if windows != nil {
+		merged = append(merged, *windows)
+	}
+
+	merged = append(merged, palettes...)
+
+	for _, fragments := range objects {
+		merged = append(merged, fragments...)
+	}
+
+	merged = append(merged, pesSegment{segmentType: segment.SegmentTypeEnd})
+
+	return p.toPes(epoch[0][0].Pid, presentationTimestamp, merged)
+}
+
+// clearingDisplaySet Display set removing the objects shown by the given display set
+func (p *playlistDemuxer) clearingDisplaySet(shown []ts.Pes) []ts.Pes {
+	pcs := *p.pcs(shown)
+	pcs.CompositionNumber = (pcs.CompositionNumber + 1) % 65536
+	pcs.CompositionState = segment.CompositionStateNormal
+	pcs.PaletteUpdateFlag = false
+	pcs.CompositionObjects = nil
+
+	return p.toPes(shown[0].Pid, 0, []pesSegment{
+		p.pcsSegment(pcs),
+		{segmentType: segment.SegmentTypeEnd},
+	})
+}
+
+// hasSegment Whether the segments of a PES packet contain a segment of the given type
+func (p *playlistDemuxer) hasSegment(data []byte, segmentType segment.SegmentType) bool {
+	segmentTypeByte := p.segmentMapper.FromSegmentType(segmentType)
+
+	for len(data) >= 3 {
+		if data[0] == segmentTypeByte {
+			return true
+		}
+
+		size := 3 + (int(data[1])<<8 | int(data[2]))
+
+		if size > len(data) {
+			return false
+		}
+
+		data = data[size:]
+	}
+
+	return false
+}
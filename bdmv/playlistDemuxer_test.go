@@ -0,0 +1,270 @@
+package bdmv
+
+import (
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/pgs"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"github.com/mbiamont/go-pgs-parser/ts"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+	"time"
+)
+
+const testPid = 0x1200
+
+const (
+	testPds = 0x14
+	testOds = 0x15
+	testPcs = 0x16
+	testWds = 0x17
+	testEnd = 0x80
+)
+
+// pesWithSegment Build a PES packet holding a single segment
+func pesWithSegment(presentationTimestamp time.Duration, segmentType byte, payload []byte) ts.Pes {
+	return ts.Pes{
+		Pid:                   testPid,
+		PresentationTimestamp: int64(presentationTimestamp * 90000 / time.Second),
+		Data:                  append([]byte{segmentType, byte(len(payload) >> 8), byte(len(payload))}, payload...),
+	}
+}
+
+// testDisplaySet Display set at the given time showing the given objects, the epoch start ones defining the window,
+// the palette and the objects
+func testDisplaySet(presentationTimestamp time.Duration, compositionNumber int, compositionState segment.CompositionState, objectIds ...int) []ts.Pes {
+	compositionStateByte := segment.NewSegmentMapper().FromCompositionState(compositionState)
+	pcs := []byte{0x07, 0x80, 0x04, 0x38, segment.FrameRate23976, byte(compositionNumber >> 8), byte(compositionNumber), compositionStateByte, 0, 0, byte(len(objectIds))}
+
+	for _, objectId := range objectIds {
+		pcs = append(pcs, byte(objectId>>8), byte(objectId), 0, 0, 0x03, 0x00, 0x03, 0x84)
+	}
+
+	pes := []ts.Pes{pesWithSegment(presentationTimestamp, testPcs, pcs)}
+
+	if compositionState == segment.CompositionStateEpochStart {
+		palette := color.Palette{color.Transparent, color.White}
+		img := image.NewPaletted(image.Rect(0, 0, 20, 10), palette)
+
+		for i := range img.Pix {
+			img.Pix[i] = 1
+		}
+
+		rle := displaySet.RleEncode(img)
+		ods := []byte{0, 0, 0, 0xC0, byte((len(rle) + 4) >> 16), byte((len(rle) + 4) >> 8), byte(len(rle) + 4), 0, 20, 0, 10}
+
+		pes = append(pes,
+			pesWithSegment(presentationTimestamp, testWds, []byte{1, 0, 0x03, 0x00, 0x03, 0x84, 0, 20, 0, 10}),
+			pesWithSegment(presentationTimestamp, testPds, []byte{0, 0, 1, 235, 128, 128, 255}),
+			pesWithSegment(presentationTimestamp, testOds, append(ods, rle...)),
+		)
+	}
+
+	return append(pes, pesWithSegment(presentationTimestamp, testEnd, nil))
+}
+
+// pesQueue Demuxer returning the given PES packets
+type pesQueue []ts.Pes
+
+func (q *pesQueue) Streams() ([]ts.Stream, error) {
+	return nil, nil
+}
+
+func (q *pesQueue) NextPes(pid int) (*ts.Pes, error) {
+	if len(*q) == 0 {
+		return nil, io.EOF
+	}
+
+	pes := (*q)[0]
+	*q = (*q)[1:]
+
+	return &pes, nil
+}
+
+type testImage struct {
+	startTime time.Duration
+	endTime   time.Duration
+}
+
+// playItemImages Images of the display sets kept from a play item of the clip timeline from 10s to 20s
+func playItemImages(t *testing.T, displaySets ...[]ts.Pes) []testImage {
+	t.Helper()
+
+	playItem := PlayItem{ClipName: "00001", inTime: 10 * 45000, outTime: 20 * 45000}
+	demuxer := newPlaylistDemuxer("", Playlist{PlayItems: []PlayItem{playItem}})
+
+	for _, set := range displaySets {
+		demuxer.current = set
+		demuxer.queueDisplaySet()
+	}
+
+	// End of the clip
+	demuxer.end(playItem, nil)
+
+	queue := pesQueue(demuxer.pendingPes)
+	var images []testImage
+
+	err := pgs.NewPgsParser().ParsePgsFromReader(ts.NewSupReader(&queue, testPid), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		images = append(images, testImage{startTime: data.StartTime, endTime: data.EndTime})
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return images
+}
+
+func TestPlayItemBoundaries(t *testing.T) {
+	tests := []struct {
+		name        string
+		displaySets [][]ts.Pes
+		expected    []testImage
+	}{
+		{
+			name: "cleared within the play item",
+			displaySets: [][]ts.Pes{
+				testDisplaySet(12*time.Second, 0, segment.CompositionStateEpochStart, 0),
+				testDisplaySet(14*time.Second, 1, segment.CompositionStateNormal),
+			},
+			expected: []testImage{{2 * time.Second, 4 * time.Second}},
+		},
+		{
+			name: "cleared after the out time",
+			displaySets: [][]ts.Pes{
+				testDisplaySet(16*time.Second, 0, segment.CompositionStateEpochStart, 0),
+				testDisplaySet(25*time.Second, 1, segment.CompositionStateNormal),
+			},
+			expected: []testImage{{6 * time.Second, 10 * time.Second}},
+		},
+		{
+			name: "replaced after the out time",
+			displaySets: [][]ts.Pes{
+				testDisplaySet(17*time.Second, 0, segment.CompositionStateEpochStart, 0),
+				testDisplaySet(22*time.Second, 1, segment.CompositionStateEpochStart, 0),
+			},
+			expected: []testImage{{7 * time.Second, 10 * time.Second}},
+		},
+		{
+			name: "never cleared",
+			displaySets: [][]ts.Pes{
+				testDisplaySet(18*time.Second, 0, segment.CompositionStateEpochStart, 0),
+			},
+			expected: []testImage{{8 * time.Second, 10 * time.Second}},
+		},
+		{
+			name: "shown before the in time",
+			displaySets: [][]ts.Pes{
+				testDisplaySet(5*time.Second, 0, segment.CompositionStateEpochStart, 0),
+				testDisplaySet(12*time.Second, 1, segment.CompositionStateNormal),
+			},
+			expected: []testImage{{0, 2 * time.Second}},
+		},
+		{
+			name: "cleared before the in time",
+			displaySets: [][]ts.Pes{
+				testDisplaySet(5*time.Second, 0, segment.CompositionStateEpochStart, 0),
+				testDisplaySet(7*time.Second, 1, segment.CompositionStateNormal),
+				testDisplaySet(12*time.Second, 2, segment.CompositionStateNormal, 0),
+				testDisplaySet(13*time.Second, 3, segment.CompositionStateNormal),
+			},
+			expected: []testImage{{2 * time.Second, 3 * time.Second}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			images := playItemImages(t, test.displaySets...)
+
+			if len(images) != len(test.expected) {
+				t.Fatalf("expected images %v, got %v", test.expected, images)
+			}
+
+			for i := range images {
+				if images[i] != test.expected[i] {
+					t.Fatalf("expected images %v, got %v", test.expected, images)
+				}
+			}
+		})
+	}
+}
+
+func TestSkipAnglesWithoutAngle(t *testing.T) {
+	data := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	reader, err := readerAt(data, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := skipAngles(reader); err == nil {
+		t.Fatal("expected an error for an angle count of 0")
+	}
+}
+
+func TestMergeEpochKeepsCompositionObjects(t *testing.T) {
+	demuxer := newPlaylistDemuxer("", Playlist{})
+	epochStart := testDisplaySet(5*time.Second, 0, segment.CompositionStateEpochStart, 0)
+
+	// Palette update showing object 0 cropped and forced
+	pcs := []byte{0x07, 0x80, 0x04, 0x38, segment.FrameRate23976, 0, 1, 0x00, 0x80, 0, 1, 0, 0, 0, 0xC0, 0x03, 0x00, 0x03, 0x84, 0, 2, 0, 1, 0, 10, 0, 5}
+	paletteUpdate := []ts.Pes{
+		pesWithSegment(7*time.Second, testPcs, pcs),
+		pesWithSegment(7*time.Second, testPds, []byte{0, 1, 1, 16, 128, 128, 255}),
+		pesWithSegment(7*time.Second, testEnd, nil),
+	}
+
+	merged := demuxer.mergeEpoch([][]ts.Pes{epochStart, paletteUpdate}, 10*90000)
+	var segmentTypes []segment.SegmentType
+
+	for _, pesSegment := range demuxer.segments(merged) {
+		segmentTypes = append(segmentTypes, pesSegment.segmentType)
+	}
+
+	expectedTypes := []segment.SegmentType{segment.SegmentTypePcs, segment.SegmentTypeWds, segment.SegmentTypePds, segment.SegmentTypeOds, segment.SegmentTypeEnd}
+
+	if len(segmentTypes) != len(expectedTypes) {
+		t.Fatalf("expected segments %v, got %v", expectedTypes, segmentTypes)
+	}
+
+	for i := range expectedTypes {
+		if segmentTypes[i] != expectedTypes[i] {
+			t.Fatalf("expected segments %v, got %v", expectedTypes, segmentTypes)
+		}
+	}
+
+	// The palette defined last is kept
+	if pds := demuxer.segments(merged)[2].payload; pds[1] != 1 {
+		t.Fatalf("expected palette version 1, got %d", pds[1])
+	}
+
+	mergedPcs := demuxer.pcs(merged)
+	expected := segment.CompositionObject{
+		ObjectId:                         0,
+		WindowId:                         0,
+		ObjectCroppedFlag:                true,
+		ObjectForcedOnFlag:               true,
+		ObjectHorizontalPosition:         768,
+		ObjectVerticalPosition:           900,
+		ObjectCroppingHorizontalPosition: 2,
+		ObjectCroppingVerticalPosition:   1,
+		ObjectCroppingWidth:              10,
+		ObjectCroppingHeight:             5,
+	}
+
+	if mergedPcs.CompositionState != segment.CompositionStateEpochStart || mergedPcs.PaletteUpdateFlag || mergedPcs.CompositionNumber != 1 {
+		t.Fatalf("expected an epoch start without palette update, got %+v", mergedPcs)
+	}
+
+	if len(mergedPcs.CompositionObjects) != 1 || mergedPcs.CompositionObjects[0] != expected {
+		t.Fatalf("expected composition object %+v, got %+v", expected, mergedPcs.CompositionObjects)
+	}
+
+	if merged[0].PresentationTimestamp != 10*90000 {
+		t.Fatalf("expected the merged display set to be presented at the in time, got %d", merged[0].PresentationTimestamp)
+	}
+}
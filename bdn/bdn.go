@@ -0,0 +1,186 @@
+package bdn
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/pgs"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FrameRate Frame rate used by BDN timecodes
+type FrameRate float64
+
+const (
+	FrameRate23976 FrameRate = 24000.0 / 1001
+	FrameRate24    FrameRate = 24
+	FrameRate25    FrameRate = 25
+	FrameRate2997  FrameRate = 30000.0 / 1001
+	FrameRate50    FrameRate = 50
+	FrameRate5994  FrameRate = 60000.0 / 1001
+)
+
+// Bdn Bitmap subtitles described by a BDN XML index, as used by BDSup2Sub and most Blu-ray authoring suites
+type Bdn struct {
+	Title       string
+	Language    string
+	VideoWidth  int
+	VideoHeight int
+	FrameRate   FrameRate
+	Subtitles   []pgs.Subtitle
+}
+
+type bdnXml struct {
+	XMLName     xml.Name       `xml:"BDN"`
+	Version     string         `xml:"Version,attr"`
+	Description descriptionXml `xml:"Description"`
+	Events      []eventXml     `xml:"Events>Event"`
+}
+
+type descriptionXml struct {
+	Name     nameXml          `xml:"Name"`
+	Language languageXml      `xml:"Language"`
+	Format   formatXml        `xml:"Format"`
+	Events   eventsSummaryXml `xml:"Events"`
+}
+
+type nameXml struct {
+	Title   string `xml:"Title,attr"`
+	Content string `xml:"Content,attr"`
+}
+
+type languageXml struct {
+	Code string `xml:"Code,attr"`
+}
+
+type formatXml struct {
+	VideoFormat string `xml:"VideoFormat,attr"`
+	FrameRate   string `xml:"FrameRate,attr"`
+	DropFrame   string `xml:"DropFrame,attr"`
+}
+
+type eventsSummaryXml struct {
+	Type           string `xml:"Type,attr"`
+	FirstEventInTC string `xml:"FirstEventInTC,attr"`
+	LastEventOutTC string `xml:"LastEventOutTC,attr"`
+	NumberOfEvents int    `xml:"NumberofEvents,attr"`
+}
+
+type eventXml struct {
+	InTC     string       `xml:"InTC,attr"`
+	OutTC    string       `xml:"OutTC,attr"`
+	Forced   string       `xml:"Forced,attr"`
+	Graphics []graphicXml `xml:"Graphic"`
+}
+
+type graphicXml struct {
+	Width    int    `xml:"Width,attr"`
+	Height   int    `xml:"Height,attr"`
+	X        int    `xml:"X,attr"`
+	Y        int    `xml:"Y,attr"`
+	FileName string `xml:",chardata"`
+}
+
+// String Frame rate as written in BDN files, e.g. "23.976"
+func (f FrameRate) String() string {
+	return strconv.FormatFloat(math.Round(float64(f)*1000)/1000, 'f', -1, 64)
+}
+
+// parseFrameRate Parse a BDN frame rate, NTSC rates written with 3 decimals being mapped to their exact value
+func parseFrameRate(value string) (FrameRate, error) {
+	for _, frameRate := range []FrameRate{FrameRate23976, FrameRate24, FrameRate25, FrameRate2997, FrameRate50, FrameRate5994} {
+		if frameRate.String() == value {
+			return frameRate, nil
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("invalid frame rate %q", value)
+	}
+
+	return FrameRate(parsed), nil
+}
+
+// toTimecode Format a time as HH:MM:SS:FF, where HH:MM:SS is the wall-clock time and FF the frames of the remaining milliseconds, as BDSup2Sub does
+func (f FrameRate) toTimecode(t time.Duration) string {
+	seconds := int(t / time.Second)
+	frames := int(math.Round((t % time.Second).Seconds() * float64(f)))
+
+	if float64(frames) >= float64(f) {
+		seconds++
+		frames = 0
+	}
+
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60, frames)
+}
+
+// fromTimecode Parse a HH:MM:SS:FF timecode
+func (f FrameRate) fromTimecode(timecode string) (time.Duration, error) {
+	var hours, minutes, seconds, frames int
+
+	_, err := fmt.Sscanf(timecode, "%d:%d:%d:%d", &hours, &minutes, &seconds, &frames)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid timecode %q: %w", timecode, err)
+	}
+
+	wallClock := time.Duration((hours*60+minutes)*60+seconds) * time.Second
+	remainder := time.Duration(math.Round(float64(frames) / float64(f) * float64(time.Second)))
+
+	return wallClock + remainder, nil
+}
+
+// videoFormat BDN video format name of a video height, which is unknown when no subtitle was found
+func videoFormat(videoHeight int) (string, error) {
+	switch {
+	case videoHeight <= 0:
+		return "", errors.New("no subtitle found, the video format is unknown")
+	case videoHeight <= 480:
+		return "480i", nil
+	case videoHeight <= 576:
+		return "576i", nil
+	case videoHeight <= 720:
+		return "720p", nil
+	case videoHeight <= 1080:
+		return "1080p", nil
+	}
+
+	return "2160p", nil
+}
+
+// videoSize Video size of a BDN video format name
+func videoSize(videoFormat string) (int, int, error) {
+	switch videoFormat {
+	case "480i", "480p":
+		return 720, 480, nil
+	case "576i", "576p":
+		return 720, 576, nil
+	case "720p":
+		return 1280, 720, nil
+	case "1080i", "1080p":
+		return 1920, 1080, nil
+	case "2160p":
+		return 3840, 2160, nil
+	}
+
+	return 0, 0, fmt.Errorf("unknown video format %q", videoFormat)
+}
+
+// formatBool BDN representation of a boolean attribute
+func formatBool(value bool) string {
+	if value {
+		return "True"
+	}
+
+	return "False"
+}
+
+// parseBool Parse a BDN boolean attribute, anything but "True" being false
+func parseBool(value string) bool {
+	return strings.EqualFold(strings.TrimSpace(value), "True")
+}
@@ -0,0 +1,196 @@
+package bdn
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/pgs"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const bdnVersion = "0.93"
+
+type BdnExporter interface {
+	// Export Parse the input file path and write each subtitle picture as a PNG next to the BDN XML file at the output file path
+	Export(inputFilePath string, outputXmlFilePath string) error
+
+	// ExportFromReader Parse the SUP stream read from reader and write each subtitle picture as a PNG next to the BDN XML file at the output file path
+	ExportFromReader(reader io.Reader, outputXmlFilePath string) error
+}
+
+// exportedImage Image written as a PNG, index being its position in the stream
+type exportedImage struct {
+	index    int
+	fileName string
+	data     displaySet.ImageData
+}
+
+type bdnExporter struct {
+	parser    pgs.PgsParser
+	frameRate FrameRate
+	language  string
+}
+
+// NewBdnExporter Initialize a new BDN exporter, using the parser to read subtitles and the frame rate to write timecodes.
+// The language is an ISO 639-2 code, e.g. "eng"
+func NewBdnExporter(parser pgs.PgsParser, frameRate FrameRate, language string) BdnExporter {
+	return &bdnExporter{
+		parser:    parser,
+		frameRate: frameRate,
+		language:  language,
+	}
+}
+
+func (b *bdnExporter) Export(inputFilePath string, outputXmlFilePath string) error {
+	file, err := os.Open(inputFilePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return b.ExportFromReader(file, outputXmlFilePath)
+}
+
+func (b *bdnExporter) ExportFromReader(reader io.Reader, outputXmlFilePath string) error {
+	directory := filepath.Dir(outputXmlFilePath)
+	title := strings.TrimSuffix(filepath.Base(outputXmlFilePath), filepath.Ext(outputXmlFilePath))
+
+	// The parser may call back from several goroutines and in any order with WithUnorderedCallbacks
+	var mutex sync.Mutex
+	var images []exportedImage
+
+	err := b.parser.ParsePgsFromReader(reader, func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		fileName := fmt.Sprintf("%s_%04d.png", title, index+1)
+
+		err := b.writePng(filepath.Join(directory, fileName), data)
+
+		if err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		images = append(images, exportedImage{
+			index:    index,
+			fileName: fileName,
+			data:     data,
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].index < images[j].index
+	})
+
+	var events []eventXml
+	videoHeight := 0
+	var firstInTime, lastOutTime time.Duration
+
+	for i, exported := range images {
+		if i == 0 {
+			firstInTime = exported.data.StartTime
+		}
+
+		lastOutTime = exported.data.EndTime
+		videoHeight = exported.data.VideoHeight
+
+		events = append(events, eventXml{
+			InTC:   b.frameRate.toTimecode(exported.data.StartTime),
+			OutTC:  b.frameRate.toTimecode(exported.data.EndTime),
+			Forced: formatBool(exported.data.Forced),
+			Graphics: []graphicXml{
+				{
+					Width:    exported.data.Width,
+					Height:   exported.data.Height,
+					X:        exported.data.X,
+					Y:        exported.data.Y,
+					FileName: exported.fileName,
+				},
+			},
+		})
+	}
+
+	format, err := videoFormat(videoHeight)
+
+	if err != nil {
+		return err
+	}
+
+	index := bdnXml{
+		Version: bdnVersion,
+		Description: descriptionXml{
+			Name:     nameXml{Title: title},
+			Language: languageXml{Code: b.language},
+			Format: formatXml{
+				VideoFormat: format,
+				FrameRate:   b.frameRate.String(),
+				DropFrame:   formatBool(false),
+			},
+			Events: eventsSummaryXml{
+				Type:           "Graphic",
+				FirstEventInTC: b.frameRate.toTimecode(firstInTime),
+				LastEventOutTC: b.frameRate.toTimecode(lastOutTime),
+				NumberOfEvents: len(events),
+			},
+		},
+		Events: events,
+	}
+
+	return b.writeXml(outputXmlFilePath, index)
+}
+
+func (b *bdnExporter) writePng(filePath string, data displaySet.ImageData) error {
+	f, err := os.Create(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return png.Encode(f, data.Image)
+}
+
+func (b *bdnExporter) writeXml(filePath string, index bdnXml) error {
+	f, err := os.Create(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = io.WriteString(f, xml.Header)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(f)
+	encoder.Indent("", "  ")
+
+	err = encoder.Encode(index)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(f, "\n")
+
+	return err
+}
@@ -0,0 +1,150 @@
+package bdn
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/pgs"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type BdnImporter interface {
+	// Import Read the BDN XML file at the input file path and the PNG pictures it references
+	Import(inputXmlFilePath string) (*Bdn, error)
+}
+
+type bdnImporter struct {
+}
+
+// NewBdnImporter Initialize a new BDN importer
+func NewBdnImporter() BdnImporter {
+	return &bdnImporter{}
+}
+
+func (b *bdnImporter) Import(inputXmlFilePath string) (*Bdn, error) {
+	content, err := os.ReadFile(inputXmlFilePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var index bdnXml
+
+	err = xml.Unmarshal(content, &index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	frameRate, err := parseFrameRate(index.Description.Format.FrameRate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	videoWidth, videoHeight, err := videoSize(index.Description.Format.VideoFormat)
+
+	if err != nil {
+		return nil, err
+	}
+
+	directory := filepath.Dir(inputXmlFilePath)
+	var subtitles []pgs.Subtitle
+
+	for _, event := range index.Events {
+		subtitle, err := b.importEvent(directory, frameRate, event)
+
+		if err != nil {
+			return nil, err
+		}
+
+		subtitles = append(subtitles, *subtitle)
+	}
+
+	return &Bdn{
+		Title:       index.Description.Name.Title,
+		Language:    index.Description.Language.Code,
+		VideoWidth:  videoWidth,
+		VideoHeight: videoHeight,
+		FrameRate:   frameRate,
+		Subtitles:   subtitles,
+	}, nil
+}
+
+// importEvent Read the pictures of an event, several graphics being composited into a single picture
+func (b *bdnImporter) importEvent(directory string, frameRate FrameRate, event eventXml) (*pgs.Subtitle, error) {
+	startTime, err := frameRate.fromTimecode(event.InTC)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endTime, err := frameRate.fromTimecode(event.OutTC)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(event.Graphics) == 0 {
+		return nil, fmt.Errorf("event at %s has no graphic", event.InTC)
+	}
+
+	var pictures []image.Image
+	bounds := image.Rectangle{}
+
+	for i, graphic := range event.Graphics {
+		picture, err := b.readPng(filepath.Join(directory, strings.TrimSpace(graphic.FileName)))
+
+		if err != nil {
+			return nil, err
+		}
+
+		pictureBounds := image.Rect(graphic.X, graphic.Y, graphic.X+picture.Bounds().Dx(), graphic.Y+picture.Bounds().Dy())
+
+		if i == 0 {
+			bounds = pictureBounds
+		} else {
+			bounds = bounds.Union(pictureBounds)
+		}
+
+		pictures = append(pictures, picture)
+	}
+
+	img := pictures[0]
+
+	if len(pictures) > 1 {
+		composite := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+		for i, picture := range pictures {
+			position := image.Pt(event.Graphics[i].X, event.Graphics[i].Y).Sub(bounds.Min)
+			draw.Draw(composite, picture.Bounds().Sub(picture.Bounds().Min).Add(position), picture, picture.Bounds().Min, draw.Over)
+		}
+
+		img = composite
+	}
+
+	return &pgs.Subtitle{
+		Image:     img,
+		StartTime: startTime,
+		EndTime:   endTime,
+		X:         bounds.Min.X,
+		Y:         bounds.Min.Y,
+		Forced:    parseBool(event.Forced),
+	}, nil
+}
+
+func (b *bdnImporter) readPng(filePath string) (image.Image, error) {
+	f, err := os.Open(filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return png.Decode(f)
+}
@@ -0,0 +1,144 @@
+package bdn
+
+import (
+	"bytes"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/pgs"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encodeSubtitles SUP stream of 1080p subtitles showing a white rectangle, forced or not
+func encodeSubtitles(t *testing.T, forced ...bool) []byte {
+	t.Helper()
+
+	var subtitles []pgs.Subtitle
+
+	for i, f := range forced {
+		img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+
+		for j := range img.Pix {
+			img.Pix[j] = 255
+		}
+
+		subtitles = append(subtitles, pgs.Subtitle{
+			Image:     img,
+			StartTime: time.Duration(2*i+1) * time.Second,
+			EndTime:   time.Duration(2*i+2) * time.Second,
+			X:         100,
+			Y:         900,
+			Forced:    f,
+		})
+	}
+
+	var sup bytes.Buffer
+
+	err := pgs.NewSupEncoder(1920, 1080, displaySet.ColorConversion{}).Encode(&sup, subtitles)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sup.Bytes()
+}
+
+func TestExportAndImportForcedFlag(t *testing.T) {
+	xmlFilePath := filepath.Join(t.TempDir(), "subtitles.xml")
+
+	err := NewBdnExporter(pgs.NewPgsParser(), FrameRate23976, "eng").ExportFromReader(bytes.NewReader(encodeSubtitles(t, false, true)), xmlFilePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xmlFile, err := os.ReadFile(xmlFilePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(xmlFile), `Forced="False"`) || !strings.Contains(string(xmlFile), `Forced="True"`) {
+		t.Fatalf("expected a forced and a non forced event in:\n%s", xmlFile)
+	}
+
+	if !strings.Contains(string(xmlFile), `VideoFormat="1080p"`) {
+		t.Fatalf("expected a 1080p video format in:\n%s", xmlFile)
+	}
+
+	bdn, err := NewBdnImporter().Import(xmlFilePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bdn.Subtitles) != 2 {
+		t.Fatalf("expected 2 subtitles, got %d", len(bdn.Subtitles))
+	}
+
+	if bdn.Subtitles[0].Forced || !bdn.Subtitles[1].Forced {
+		t.Fatalf("expected only the second subtitle to be forced, got %v and %v", bdn.Subtitles[0].Forced, bdn.Subtitles[1].Forced)
+	}
+}
+
+func TestExportWithoutSubtitle(t *testing.T) {
+	xmlFilePath := filepath.Join(t.TempDir(), "subtitles.xml")
+
+	err := NewBdnExporter(pgs.NewPgsParser(), FrameRate23976, "eng").ExportFromReader(bytes.NewReader(nil), xmlFilePath)
+
+	if err == nil {
+		t.Fatal("expected an error exporting a stream without subtitle")
+	}
+
+	if _, err := os.Stat(xmlFilePath); !os.IsNotExist(err) {
+		t.Fatalf("expected no BDN XML file to be written, got %v", err)
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	for value, expected := range map[string]bool{"True": true, "true": true, " TRUE ": true, "False": false, "": false, "1": false} {
+		if got := parseBool(value); got != expected {
+			t.Fatalf("expected %q to be %v, got %v", value, expected, got)
+		}
+	}
+}
+
+func TestExportWithUnorderedWorkers(t *testing.T) {
+	forced := make([]bool, 40)
+
+	for i := range forced {
+		forced[i] = i%3 == 0
+	}
+
+	sup := encodeSubtitles(t, forced...)
+
+	export := func(parser pgs.PgsParser) string {
+		t.Helper()
+
+		xmlFilePath := filepath.Join(t.TempDir(), "subtitles.xml")
+
+		err := NewBdnExporter(parser, FrameRate23976, "eng").ExportFromReader(bytes.NewReader(sup), xmlFilePath)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		xmlFile, err := os.ReadFile(xmlFilePath)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(xmlFile)
+	}
+
+	expected := export(pgs.NewPgsParser())
+	got := export(pgs.NewPgsParser(pgs.WithWorkers(4), pgs.WithUnorderedCallbacks()))
+
+	if got != expected {
+		t.Fatalf("expected the same BDN XML as a sequential export:\n%s\ngot:\n%s", expected, got)
+	}
+}
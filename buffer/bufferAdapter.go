@@ -5,3 +5,26 @@ type BufferAdapter interface {
 	At(index int) (int, error)
 	SubArray(start int, end int) BufferAdapter
 }
+
+// contiguousBuffer A BufferAdapter backed by a single slice, which can be read without going through At
+type contiguousBuffer interface {
+	Bytes() []byte
+}
+
+// Bytes Return the content of the buffer as a slice, which is the backing slice itself when the buffer has one.
+// Other buffers are copied byte by byte
+func Bytes(buffer BufferAdapter) []byte {
+	if contiguous, ok := buffer.(contiguousBuffer); ok {
+		return contiguous.Bytes()
+	}
+
+	bytes := make([]byte, buffer.Length())
+
+	for i := range bytes {
+		// At can't fail below Length
+		b, _ := buffer.At(i)
+		bytes[i] = byte(b)
+	}
+
+	return bytes
+}
@@ -1,23 +1,38 @@
 package buffer
 
+import (
+	"encoding/binary"
+	"errors"
+)
+
 type BufferReader interface {
 	Index() int
 	HasNext() bool
 	ReadBytes(count int) (int, error)
 	ReadBytesWithLimit(count int, limit *int) (int, error)
 	ReadBuffer(count int) BufferAdapter
+	ReadByteSlice(count int) ([]byte, error)
 }
 
 type bufferReader struct {
 	buffer BufferAdapter
 	index  int
+
+	// bytes Backing slice of buffer if it has one, read directly instead of calling At for each byte
+	bytes []byte
 }
 
 func NewBufferReader(bufferAdapter BufferAdapter) BufferReader {
-	return &bufferReader{
+	reader := &bufferReader{
 		buffer: bufferAdapter,
 		index:  0,
 	}
+
+	if contiguous, ok := bufferAdapter.(contiguousBuffer); ok {
+		reader.bytes = contiguous.Bytes()
+	}
+
+	return reader
 }
 
 func (b *bufferReader) Index() int {
@@ -37,6 +52,10 @@ func (b *bufferReader) ReadBytesWithLimit(count int, limit *int) (int, error) {
 		return 0, nil
 	}
 
+	if b.bytes != nil {
+		return b.readBigEndian(count)
+	}
+
 	number := 0
 	digit := 0
 	from := b.index
@@ -57,9 +76,52 @@ func (b *bufferReader) ReadBytesWithLimit(count int, limit *int) (int, error) {
 	return number, nil
 }
 
+// readBigEndian ReadBytesWithLimit on the backing slice
+func (b *bufferReader) readBigEndian(count int) (int, error) {
+	if count < 0 || b.index+count > len(b.bytes) {
+		return 0, errors.New("index out of bounds")
+	}
+
+	bytes := b.bytes[b.index : b.index+count]
+	number := 0
+
+	switch count {
+	case 1:
+		number = int(bytes[0])
+	case 2:
+		number = int(binary.BigEndian.Uint16(bytes))
+	case 4:
+		number = int(binary.BigEndian.Uint32(bytes))
+	default:
+		for _, bb := range bytes {
+			number = number<<8 | int(bb)
+		}
+	}
+
+	b.index += count
+
+	return number, nil
+}
+
 func (b *bufferReader) ReadBuffer(count int) BufferAdapter {
+	if b.bytes != nil {
+		buffer := NewUint8ArrayBuffer(b.bytes[b.index : b.index+count])
+		b.index += count
+
+		return buffer
+	}
+
 	buffer := b.buffer.SubArray(b.index, b.index+count)
 	b.index += count
 
 	return buffer
 }
+
+// ReadByteSlice Read count bytes at once, sharing the memory of the buffer when it has a backing slice
+func (b *bufferReader) ReadByteSlice(count int) ([]byte, error) {
+	if count < 0 || b.index+count > b.buffer.Length() {
+		return nil, errors.New("index out of bounds")
+	}
+
+	return Bytes(b.ReadBuffer(count)), nil
+}
@@ -0,0 +1,45 @@
+package buffer
+
+type BufferWriter interface {
+	Length() int
+	WriteBytes(value int, count int)
+	WriteByteSlice(data []byte)
+	WriteBuffer(buffer BufferAdapter) error
+	Bytes() []byte
+}
+
+type bufferWriter struct {
+	buffer []byte
+}
+
+func NewBufferWriter() BufferWriter {
+	return &bufferWriter{
+		buffer: []byte{},
+	}
+}
+
+func (b *bufferWriter) Length() int {
+	return len(b.buffer)
+}
+
+// WriteBytes Write value as a big endian number of count bytes
+func (b *bufferWriter) WriteBytes(value int, count int) {
+	for i := count - 1; i >= 0; i-- {
+		b.buffer = append(b.buffer, byte(value>>(8*i)))
+	}
+}
+
+// WriteByteSlice Append data as is
+func (b *bufferWriter) WriteByteSlice(data []byte) {
+	b.buffer = append(b.buffer, data...)
+}
+
+func (b *bufferWriter) WriteBuffer(buffer BufferAdapter) error {
+	b.buffer = append(b.buffer, Bytes(buffer)...)
+
+	return nil
+}
+
+func (b *bufferWriter) Bytes() []byte {
+	return b.buffer
+}
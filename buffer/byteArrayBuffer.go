@@ -28,3 +28,8 @@ func (u *ByteArrayBuffer) At(index int) (int, error) {
 func (u *ByteArrayBuffer) SubArray(start int, end int) BufferAdapter {
 	return NewUint8ArrayBuffer(u.buffer[start:end])
 }
+
+// Bytes Backing slice of the buffer, which must not be modified
+func (u *ByteArrayBuffer) Bytes() []byte {
+	return u.buffer
+}
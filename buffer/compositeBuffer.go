@@ -56,3 +56,18 @@ func (c *CompositeBuffer) SubArray(start int, end int) BufferAdapter {
 
 	return NewCompositeBuffer(chunks)
 }
+
+// Bytes Concatenation of the buffers, the single buffer's backing slice being returned as is when there's only one
+func (c *CompositeBuffer) Bytes() []byte {
+	if len(c.buffers) == 1 {
+		return Bytes(c.buffers[0])
+	}
+
+	bytes := make([]byte, 0, c.Length())
+
+	for _, buffer := range c.buffers {
+		bytes = append(bytes, Bytes(buffer)...)
+	}
+
+	return bytes
+}
@@ -9,11 +9,16 @@ type CompositeBufferReader interface {
 
 	Length() int
 
+	// ReadBytes Read the next count bytes, as a view of the added slice when they're all in the same one and as a copy otherwise
 	ReadBytes(count int) (BufferAdapter, error)
+
+	// Unread Put back bytes in front of the remaining ones, so that they're read again
+	Unread(buffer BufferAdapter)
 }
 
 type compositeBufferReader struct {
-	buffers []BufferAdapter
+	chunks [][]byte
+	length int
 }
 
 func NewCompositeBufferReader() CompositeBufferReader {
@@ -21,45 +26,68 @@ func NewCompositeBufferReader() CompositeBufferReader {
 }
 
 func (c *compositeBufferReader) Add(buffer []byte) {
-	c.buffers = append(c.buffers, NewUint8ArrayBuffer(buffer))
+	if len(buffer) == 0 {
+		return
+	}
+
+	c.chunks = append(c.chunks, buffer)
+	c.length += len(buffer)
 }
 
 func (c *compositeBufferReader) Length() int {
-	length := 0
-	for _, b := range c.buffers {
-		length += b.Length()
-	}
-	return length
+	return c.length
 }
 
 func (c *compositeBufferReader) ReadBytes(count int) (BufferAdapter, error) {
+	if count > c.length {
+		return nil, errors.New("trying to read more bytes than available")
+	}
+
 	if count == 0 {
-		return NewCompositeBuffer([]BufferAdapter{}), nil
+		return NewUint8ArrayBuffer([]byte{}), nil
 	}
 
-	var chunks []BufferAdapter
-	accumulated := 0
+	c.length -= count
 
-	for true {
-		if len(c.buffers) == 0 {
-			return nil, errors.New("trying to read more bytes than available")
-		}
-		buffer := c.buffers[0]
-		c.buffers = append(c.buffers[:0], c.buffers[1:]...)
-		required := count - accumulated
-
-		if buffer.Length() == required {
-			chunks = append(chunks, buffer)
-			break
-		} else if buffer.Length() > required {
-			chunks = append(chunks, buffer.SubArray(0, required))
-			c.buffers = append([]BufferAdapter{buffer.SubArray(required, buffer.Length())}, c.buffers...)
-			break
+	if chunk := c.chunks[0]; len(chunk) >= count {
+		c.consume(count)
+
+		return NewUint8ArrayBuffer(chunk[:count:count]), nil
+	}
+
+	bytes := make([]byte, 0, count)
+
+	for len(bytes) < count {
+		chunk := c.chunks[0]
+		required := count - len(bytes)
+
+		if len(chunk) > required {
+			chunk = chunk[:required]
 		}
 
-		accumulated += buffer.Length()
-		chunks = append(chunks, buffer)
+		bytes = append(bytes, chunk...)
+		c.consume(len(chunk))
+	}
+
+	return NewUint8ArrayBuffer(bytes), nil
+}
+
+// consume Drop count bytes from the first chunk, which holds at least as many
+func (c *compositeBufferReader) consume(count int) {
+	if count < len(c.chunks[0]) {
+		c.chunks[0] = c.chunks[0][count:]
+		return
+	}
+
+	c.chunks[0] = nil
+	c.chunks = c.chunks[1:]
+}
+
+func (c *compositeBufferReader) Unread(buffer BufferAdapter) {
+	if buffer.Length() == 0 {
+		return
 	}
 
-	return NewCompositeBuffer(chunks), nil
+	c.chunks = append([][]byte{Bytes(buffer)}, c.chunks...)
+	c.length += buffer.Length()
 }
@@ -0,0 +1,96 @@
+package displaySet
+
+// ColorMatrix Coefficients used to convert palette entries from YCbCr to RGB
+type ColorMatrix uint8
+
+const (
+	ColorMatrixBt601 ColorMatrix = iota
+	ColorMatrixBt709
+	ColorMatrixBt2020
+	// ColorMatrixAuto Pick the matrix from the PCS video height: BT.601 for SD, BT.709 for HD and BT.2020 for UHD
+	ColorMatrixAuto
+)
+
+// ColorRange Range of the palette entries YCbCr values
+type ColorRange uint8
+
+const (
+	// ColorRangeFull Y, Cb and Cr use the whole 0-255 range
+	ColorRangeFull ColorRange = iota
+	// ColorRangeLimited Y uses the 16-235 range, Cb and Cr use the 16-240 range
+	ColorRangeLimited
+)
+
+// ColorConversion How palette entries are converted from YCbCr to RGB
+type ColorConversion struct {
+	Matrix ColorMatrix
+	Range  ColorRange
+}
+
+// Resolve Replace ColorMatrixAuto with the matrix matching the video height
+func (c ColorConversion) Resolve(videoHeight int) ColorConversion {
+	if c.Matrix != ColorMatrixAuto {
+		return c
+	}
+
+	if videoHeight > 1080 {
+		c.Matrix = ColorMatrixBt2020
+	} else if videoHeight >= 720 {
+		c.Matrix = ColorMatrixBt709
+	} else {
+		c.Matrix = ColorMatrixBt601
+	}
+
+	return c
+}
+
+// coefficients Red and blue luma coefficients (Kr, Kb) of the matrix
+func (c ColorConversion) coefficients() (float64, float64) {
+	switch c.Matrix {
+	case ColorMatrixBt709:
+		return 0.2126, 0.0722
+	case ColorMatrixBt2020:
+		return 0.2627, 0.0593
+	}
+
+	return 0.299, 0.114
+}
+
+// toRgb Convert YCbCr components to RGB components in the 0-255 range, before clamping
+func (c ColorConversion) toRgb(y float64, cb float64, cr float64) (float64, float64, float64) {
+	kr, kb := c.coefficients()
+	kg := 1 - kr - kb
+
+	cb -= 128
+	cr -= 128
+
+	if c.Range == ColorRangeLimited {
+		y = (y - 16) * 255 / 219
+		cb = cb * 255 / 224
+		cr = cr * 255 / 224
+	}
+
+	r := y + 2*(1-kr)*cr
+	g := y - 2*kb*(1-kb)/kg*cb - 2*kr*(1-kr)/kg*cr
+	b := y + 2*(1-kb)*cb
+
+	return r, g, b
+}
+
+// fromRgb Convert RGB components to YCbCr components, before clamping
+func (c ColorConversion) fromRgb(r float64, g float64, b float64) (float64, float64, float64) {
+	kr, kb := c.coefficients()
+	kg := 1 - kr - kb
+
+	y := kr*r + kg*g + kb*b
+	cb := (b - y) / (2 * (1 - kb))
+	cr := (r - y) / (2 * (1 - kr))
+
+	if c.Range == ColorRangeLimited {
+		y = 16 + y*219/255
+		cb = cb * 224 / 255
+		cr = cr * 224 / 255
+	}
+
+	return y, cb + 128, cr + 128
+}
@@ -0,0 +1,162 @@
+package displaySet
+
+import (
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// colorsClose Whether the colors differ by at most 1 on each component, the YCbCr values being rounded to 8 bits
+func colorsClose(a color.NRGBA, b color.NRGBA) bool {
+	for _, difference := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A)} {
+		if difference < -1 || difference > 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestColorConversion(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	green := color.NRGBA{G: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+
+	testCases := []struct {
+		name       string
+		conversion ColorConversion
+		// entries Luminance, Cb and Cr of the palette entries
+		entries  [][3]int
+		expected []color.NRGBA
+	}{
+		{
+			name:       "BT.601 limited range",
+			conversion: ColorConversion{Matrix: ColorMatrixBt601, Range: ColorRangeLimited},
+			entries:    [][3]int{{81, 90, 240}, {145, 54, 34}, {41, 240, 110}},
+			expected:   []color.NRGBA{red, green, blue},
+		},
+		{
+			name:       "BT.601 full range",
+			conversion: ColorConversion{Matrix: ColorMatrixBt601, Range: ColorRangeFull},
+			entries:    [][3]int{{76, 85, 255}, {150, 44, 21}, {29, 255, 107}},
+			expected:   []color.NRGBA{red, green, blue},
+		},
+		{
+			name:       "BT.709 limited range",
+			conversion: ColorConversion{Matrix: ColorMatrixBt709, Range: ColorRangeLimited},
+			entries:    [][3]int{{63, 102, 240}, {173, 42, 26}, {32, 240, 118}},
+			expected:   []color.NRGBA{red, green, blue},
+		},
+		{
+			name:       "BT.709 full range",
+			conversion: ColorConversion{Matrix: ColorMatrixBt709, Range: ColorRangeFull},
+			entries:    [][3]int{{54, 99, 255}, {182, 30, 12}, {18, 255, 116}},
+			expected:   []color.NRGBA{red, green, blue},
+		},
+		{
+			name:       "BT.2020 limited range",
+			conversion: ColorConversion{Matrix: ColorMatrixBt2020, Range: ColorRangeLimited},
+			entries:    [][3]int{{74, 97, 240}, {164, 47, 25}, {29, 240, 119}},
+			expected:   []color.NRGBA{red, green, blue},
+		},
+		{
+			name:       "BT.2020 full range",
+			conversion: ColorConversion{Matrix: ColorMatrixBt2020, Range: ColorRangeFull},
+			entries:    [][3]int{{67, 92, 255}, {173, 36, 11}, {15, 255, 118}},
+			expected:   []color.NRGBA{red, green, blue},
+		},
+		{
+			name:       "limited range white and black",
+			conversion: ColorConversion{Matrix: ColorMatrixBt709, Range: ColorRangeLimited},
+			entries:    [][3]int{{235, 128, 128}, {16, 128, 128}},
+			expected:   []color.NRGBA{{R: 255, G: 255, B: 255, A: 255}, {A: 255}},
+		},
+		{
+			name:       "full range grays",
+			conversion: ColorConversion{Matrix: ColorMatrixBt709, Range: ColorRangeFull},
+			entries:    [][3]int{{235, 128, 128}, {16, 128, 128}},
+			expected:   []color.NRGBA{{R: 235, G: 235, B: 235, A: 255}, {R: 16, G: 16, B: 16, A: 255}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		for i, entry := range testCase.entries {
+			got := (&displaySet{}).ycrcbToNrgba(segment.PaletteEntry{
+				Luminance:           entry[0],
+				ColorDifferenceBlue: entry[1],
+				ColorDifferenceRed:  entry[2],
+				Transparency:        255,
+			}, testCase.conversion)
+
+			if !colorsClose(got, testCase.expected[i]) {
+				t.Errorf("%s: expected %v for Y %d Cb %d Cr %d, got %v", testCase.name, testCase.expected[i], entry[0], entry[1], entry[2], got)
+			}
+		}
+	}
+}
+
+func TestColorConversionKeepsTransparency(t *testing.T) {
+	got := (&displaySet{}).ycrcbToNrgba(segment.PaletteEntry{
+		Luminance:           235,
+		ColorDifferenceBlue: 128,
+		ColorDifferenceRed:  128,
+		Transparency:        64,
+	}, ColorConversion{Matrix: ColorMatrixBt709, Range: ColorRangeLimited})
+
+	// Not premultiplied
+	if expected := (color.NRGBA{R: 255, G: 255, B: 255, A: 64}); got != expected {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestResolveColorMatrix(t *testing.T) {
+	testCases := []struct {
+		videoHeight int
+		expected    ColorMatrix
+	}{
+		{480, ColorMatrixBt601},
+		{576, ColorMatrixBt601},
+		{720, ColorMatrixBt709},
+		{1080, ColorMatrixBt709},
+		{2160, ColorMatrixBt2020},
+	}
+
+	for _, testCase := range testCases {
+		if got := (ColorConversion{Matrix: ColorMatrixAuto}).Resolve(testCase.videoHeight).Matrix; got != testCase.expected {
+			t.Errorf("expected matrix %d for a video height of %d, got %d", testCase.expected, testCase.videoHeight, got)
+		}
+	}
+
+	if got := (ColorConversion{Matrix: ColorMatrixBt601}).Resolve(2160).Matrix; got != ColorMatrixBt601 {
+		t.Errorf("expected an explicit matrix to be kept, got %d", got)
+	}
+}
+
+func TestRenderColorConversion(t *testing.T) {
+	var data []byte
+
+	// Object filled with BT.709 limited range red
+	data = append(data, testSegment(1, 0x16, testPcsPayload(0x80, testCompositionObject(0, 0, 0x00, 100, 900)))...)
+	data = append(data, testSegment(1, 0x17, testWdsPayload([5]int{0, 100, 900, 20, 10}))...)
+	data = append(data, testSegment(1, 0x14, testPdsPayload(0, [5]byte{1, 63, 240, 102, 255}))...)
+	data = append(data, testSegment(1, 0x15, testOdsPayloads(0, newBitmap(20, 10, func(x int, y int) byte {
+		return 1
+	}), 1)[0])...)
+	data = append(data, testSegment(1, 0x80, nil)...)
+
+	set := parseDisplaySets(t, data)[0]
+
+	// Original BT.601 approximation
+	rendered := renderPixels(t, set, RenderOptions{})
+
+	if got, ok := rendered.Image.(*image.RGBA); !ok || got.RGBAAt(0, 0) != (color.RGBA{R: 220, G: 0, B: 16, A: 255}) {
+		t.Fatalf("expected the original approximation in an *image.RGBA, got %T %v", rendered.Image, rendered.Image.At(0, 0))
+	}
+
+	rendered = renderPixels(t, set, RenderOptions{ColorConversion: &ColorConversion{Matrix: ColorMatrixAuto, Range: ColorRangeLimited}})
+
+	if got, ok := rendered.Image.(*image.NRGBA); !ok || !colorsClose(got.NRGBAAt(0, 0), color.NRGBA{R: 255, A: 255}) {
+		t.Fatalf("expected red in an *image.NRGBA for a 1080p video, got %T %v", rendered.Image, rendered.Image.At(0, 0))
+	}
+}
@@ -1,12 +1,14 @@
 package displaySet
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"github.com/mbiamont/go-pgs-parser/buffer"
 	"github.com/mbiamont/go-pgs-parser/segment"
 	"image"
 	"image/color"
 	"math"
+	"sort"
 	"time"
 )
 
@@ -14,152 +16,527 @@ type ImageData struct {
 	Image  image.Image
 	Width  int
 	Height int
-}
 
-type DisplaySet interface {
-	paletteDefinitionSegment(paletteId int) (*segment.PaletteDefinitionSegment, error)
+	// X Horizontal position of the image on the video frame
+	X int
+	// Y Vertical position of the image on the video frame
+	Y int
 
-	parseImageData() (*ImageData, error)
+	// VideoWidth Width of the video frame the image is displayed on
+	VideoWidth int
+	// VideoHeight Height of the video frame the image is displayed on
+	VideoHeight int
 
-	rleDecode(encodedBuffer buffer.BufferAdapter, callback func(int, int, int)) error
+	// StartTime Time at which the image is displayed
+	StartTime time.Duration
+	// EndTime Time at which the image is cleared or replaced.
+	// It depends on the following display sets, so it's equal to StartTime until filled by the PgsParser
+	EndTime time.Duration
 
-	ycrcbToRgba(palette segment.PaletteEntry) color.RGBA
+	// PaletteUpdate The image shows the objects already on screen with a new palette (e.g. for a fade)
+	PaletteUpdate bool
 
-	clamp(number float64, min int, max int) int
+	// Forced The image is displayed even when subtitles are turned off (e.g. to translate a sign)
+	Forced bool
+}
 
-	objectData() []buffer.BufferAdapter
+// Duration How long the image stays on screen
+func (i *ImageData) Duration() time.Duration {
+	return i.EndTime - i.StartTime
+}
 
-	paletteEntriesToRgba(entries []segment.PaletteEntry) []color.RGBA
+// RenderOptions Options used to render a DisplaySet into an ImageData
+type RenderOptions struct {
+	// FullCanvas Composite the objects on a transparent image the size of the video frame, at their position,
+	// instead of an image cropped to the displayed objects
+	FullCanvas bool
+
+	// ColorConversion How palette entries are converted from YCbCr to RGB, producing *image.NRGBA images.
+	// When nil, the original BT.601 approximation is used and images are *image.RGBA
+	ColorConversion *ColorConversion
+
+	// Paletted Produce an *image.Paletted indexed by the PGS palette entry ids instead of an RGBA image
+	Paletted bool
+}
 
+type DisplaySet interface {
 	ToImageData() (*ImageData, error)
 
+	ToImageDataWithOptions(options RenderOptions) (*ImageData, error)
+
+	// ToImageDataContext Render the display set with the given options, stopping with ctx.Err() once the context is done
+	ToImageDataContext(ctx context.Context, options RenderOptions) (*ImageData, error)
+
 	StartTime() time.Duration
+
+	// PresentationTimestamp PTS of the PCS in 90kHz units
+	PresentationTimestamp() int
+
+	// DecodingTimestamp DTS of the PCS in 90kHz units, usually 0
+	DecodingTimestamp() int
+
+	PresentationCompositionSegment() segment.PresentationCompositionSegment
+
+	WindowDefinitionSegments() []segment.WindowDefinitionSegment
+
+	PaletteDefinitionSegments() []segment.PaletteDefinitionSegment
+
+	ObjectDefinitionSegments() []segment.ObjectDefinitionSegment
+
+	EndDefinitionSegment() segment.Segment
+
+	CompositionNumber() int
+
+	CompositionState() segment.CompositionState
+
+	CompositionObjects() []segment.CompositionObject
+
+	IsPaletteUpdate() bool
+
+	// Windows Windows defined in the epoch up to this display set, sorted by id
+	Windows() []segment.WindowDefinition
+
+	// Palettes Palettes defined in the epoch up to this display set, sorted by id
+	Palettes() []segment.PaletteDefinitionSegment
+
+	// Palette Palette referenced by the PCS, as last defined in the epoch
+	Palette() (*segment.PaletteDefinitionSegment, error)
+
+	// Objects Objects defined in the epoch up to this display set, sorted by id
+	Objects() []Object
+
+	// Object Object with the given id as last defined in the epoch, nil if it isn't defined
+	Object(objectId int) *Object
 }
 
 type displaySet struct {
-	PresentationCompositionSegment segment.PresentationCompositionSegment
-	WindowDefinitionSegments       []segment.WindowDefinitionSegment
-	PaletteDefinitionSegments      []segment.PaletteDefinitionSegment
-	ObjectDefinitionSegments       []segment.ObjectDefinitionSegment
-	EndDefinitionSegment           segment.Segment
-
-	PreviousDisplaySet *DisplaySet
+	presentationCompositionSegment segment.PresentationCompositionSegment
+	windowDefinitionSegments       []segment.WindowDefinitionSegment
+	paletteDefinitionSegments      []segment.PaletteDefinitionSegment
+	objectDefinitionSegments       []segment.ObjectDefinitionSegment
+	endDefinitionSegment           segment.Segment
+
+	// epoch Objects, palettes and windows available to this display set
+	epoch *epoch
 }
 
 func NewDisplaySet(
+	presentationCompositionSegment segment.PresentationCompositionSegment,
+	windowDefinitionSegments []segment.WindowDefinitionSegment,
+	paletteDefinitionSegments []segment.PaletteDefinitionSegment,
+	objectDefinitionSegments []segment.ObjectDefinitionSegment,
+	endDefinitionSegment segment.Segment) DisplaySet {
+	displaySetEpoch := newEpoch()
+
+	for _, wds := range windowDefinitionSegments {
+		displaySetEpoch.addWindows(wds)
+	}
+
+	for _, pds := range paletteDefinitionSegments {
+		displaySetEpoch.addPalette(pds)
+	}
+
+	for _, ods := range objectDefinitionSegments {
+		displaySetEpoch.addObjectFragment(ods)
+	}
+
+	return newDisplaySet(
+		presentationCompositionSegment,
+		windowDefinitionSegments,
+		paletteDefinitionSegments,
+		objectDefinitionSegments,
+		endDefinitionSegment,
+		displaySetEpoch,
+	)
+}
+
+func newDisplaySet(
 	presentationCompositionSegment segment.PresentationCompositionSegment,
 	windowDefinitionSegments []segment.WindowDefinitionSegment,
 	paletteDefinitionSegments []segment.PaletteDefinitionSegment,
 	objectDefinitionSegments []segment.ObjectDefinitionSegment,
 	endDefinitionSegment segment.Segment,
-	previousDisplaySet *DisplaySet) DisplaySet {
+	displaySetEpoch *epoch) DisplaySet {
 	return &displaySet{
-		PresentationCompositionSegment: presentationCompositionSegment,
-		WindowDefinitionSegments:       windowDefinitionSegments,
-		PaletteDefinitionSegments:      paletteDefinitionSegments,
-		ObjectDefinitionSegments:       objectDefinitionSegments,
-		EndDefinitionSegment:           endDefinitionSegment,
-		PreviousDisplaySet:             previousDisplaySet,
+		presentationCompositionSegment: presentationCompositionSegment,
+		windowDefinitionSegments:       windowDefinitionSegments,
+		paletteDefinitionSegments:      paletteDefinitionSegments,
+		objectDefinitionSegments:       objectDefinitionSegments,
+		endDefinitionSegment:           endDefinitionSegment,
+		epoch:                          displaySetEpoch,
 	}
 }
 
 func (d *displaySet) ToImageData() (*ImageData, error) {
-	if len(d.ObjectDefinitionSegments) <= 0 {
-		//No image found
+	return d.ToImageDataWithOptions(RenderOptions{})
+}
+
+func (d *displaySet) ToImageDataWithOptions(options RenderOptions) (*ImageData, error) {
+	return d.ToImageDataContext(context.Background(), options)
+}
+
+func (d *displaySet) ToImageDataContext(ctx context.Context, options RenderOptions) (*ImageData, error) {
+	if len(d.CompositionObjects()) <= 0 {
+		//No object displayed
 		return nil, nil
 	}
-	return d.parseImageData()
+	return d.parseImageData(ctx, options)
 }
 
-func (d *displaySet) firstOds() *segment.ObjectDefinitionSegment {
-	for _, ods := range d.ObjectDefinitionSegments {
-		if ods.LastInSequenceFlag == segment.LastInSequenceFlagFirstInSequence || ods.LastInSequenceFlag == segment.LastInSequenceFlagFirstAndLastInSequence {
-			return &ods
-		}
-	}
-	return nil
+func (d *displaySet) object(objectId int) *Object {
+	return d.epoch.objects[objectId]
 }
 
 func (d *displaySet) paletteDefinitionSegment(paletteId int) (*segment.PaletteDefinitionSegment, error) {
-	for _, pds := range d.PaletteDefinitionSegments {
-		if pds.PaletteId == paletteId {
-			return &pds, nil
-		}
-	}
+	pds, ok := d.epoch.palettes[paletteId]
 
-	if d.PresentationCompositionSegment.CompositionState != segment.CompositionStateNormal {
-		return nil, errors.New("PCS references invalid PDS and composition state is not 'normal'")
+	if !ok {
+		return nil, fmt.Errorf("%w: PCS references palette %d which isn't defined in the current epoch", ErrUndefinedPalette, paletteId)
 	}
 
-	if d.PreviousDisplaySet != nil {
-		return (*d.PreviousDisplaySet).paletteDefinitionSegment(paletteId)
-	}
-
-	return nil, errors.New("PCS references invalid PDS and no previous display set to fallback to")
+	return pds, nil
 }
 
-func (d *displaySet) parseImageData() (*ImageData, error) {
-	pds, err := d.paletteDefinitionSegment(d.PresentationCompositionSegment.PaletteId)
+func (d *displaySet) parseImageData(ctx context.Context, options RenderOptions) (*ImageData, error) {
+	pds, err := d.paletteDefinitionSegment(d.presentationCompositionSegment.PaletteId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if pds == nil {
-		return nil, errors.New("PCS references invalid PDS")
+	var compositionObjects []segment.CompositionObject
+	var objects []*Object
+	var visibleAreas []image.Rectangle
+	bounds := image.Rectangle{}
+
+	for _, compositionObject := range d.CompositionObjects() {
+		o := d.object(compositionObject.ObjectId)
+
+		if o == nil {
+			return nil, fmt.Errorf("%w: PCS references object %d which isn't defined in the current epoch", ErrUndefinedObject, compositionObject.ObjectId)
+		}
+
+		visibleArea := d.objectBounds(compositionObject, o.Width, o.Height)
+
+		if window := d.window(compositionObject.WindowId); window != nil {
+			visibleArea = visibleArea.Intersect(image.Rect(
+				window.WindowHorizontalPosition,
+				window.WindowVerticalPosition,
+				window.WindowHorizontalPosition+window.WindowWidth,
+				window.WindowVerticalPosition+window.WindowHeight,
+			))
+		}
+
+		if options.FullCanvas {
+			visibleArea = visibleArea.Intersect(d.canvasBounds())
+		}
+
+		if visibleArea.Empty() {
+			continue
+		}
+
+		if len(objects) == 0 {
+			bounds = visibleArea
+		} else {
+			bounds = bounds.Union(visibleArea)
+		}
+
+		compositionObjects = append(compositionObjects, compositionObject)
+		objects = append(objects, o)
+		visibleAreas = append(visibleAreas, visibleArea)
 	}
 
-	firstOds := d.firstOds()
+	if len(objects) == 0 {
+		//No object displayed
+		return nil, nil
+	}
 
-	if firstOds == nil || firstOds.Width == nil || firstOds.Height == nil {
-		return nil, errors.New("missing first ODS with defined width and height")
+	if options.FullCanvas {
+		bounds = d.canvasBounds()
 	}
-	rgbaPalette := d.paletteEntriesToRgba(pds.PaletteEntries)
-	width := *firstOds.Width
-	height := *firstOds.Height
 
-	// New
+	width := bounds.Dx()
+	height := bounds.Dy()
+	forced := false
+
+	for _, compositionObject := range compositionObjects {
+		forced = forced || compositionObject.ObjectForcedOnFlag
+	}
 
 	upLeft := image.Pt(0, 0)
 	lowRight := image.Pt(width, height)
-	img := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-	err = d.rleDecode(buffer.NewCompositeBuffer(d.objectData()), func(x int, y int, paletteIndex int) {
+	rectangle := image.Rectangle{Min: upLeft, Max: lowRight}
+	var img image.Image
+	var setPixel func(x int, y int, paletteIndex int)
+	var palette color.Palette
 
-		if paletteIndex >= len(rgbaPalette) {
-			img.Set(0, 0, color.RGBA{R: 0, G: 0, B: 0, A: 255})
-		} else {
-			rgba := rgbaPalette[paletteIndex]
-			img.Set(x, y, rgba)
+	if options.ColorConversion == nil {
+		rgbaPalette := d.paletteEntriesToRgba(pds.PaletteEntries)
+		palette = make(color.Palette, len(rgbaPalette))
+
+		for i, rgba := range rgbaPalette {
+			palette[i] = rgba
 		}
-	})
 
-	if err != nil {
-		return nil, err
+		if !options.Paletted {
+			rgbaImage := image.NewRGBA(rectangle)
+			img = rgbaImage
+			setPixel = func(x int, y int, paletteIndex int) {
+				rgbaImage.SetRGBA(x, y, rgbaPalette[paletteIndex])
+			}
+		}
+	} else {
+		conversion := options.ColorConversion.Resolve(d.presentationCompositionSegment.Height)
+		nrgbaPalette := d.paletteEntriesToNrgba(pds.PaletteEntries, conversion)
+		palette = make(color.Palette, len(nrgbaPalette))
+
+		for i, nrgba := range nrgbaPalette {
+			palette[i] = nrgba
+		}
+
+		if !options.Paletted {
+			nrgbaImage := image.NewNRGBA(rectangle)
+			img = nrgbaImage
+			setPixel = func(x int, y int, paletteIndex int) {
+				nrgbaImage.SetNRGBA(x, y, nrgbaPalette[paletteIndex])
+			}
+		}
+	}
+
+	if options.Paletted {
+		palettedImage := d.newPalettedImage(rectangle, palette)
+		img = palettedImage
+		setPixel = func(x int, y int, paletteIndex int) {
+			palettedImage.SetColorIndex(x, y, uint8(paletteIndex))
+		}
+	}
+
+	for i, compositionObject := range compositionObjects {
+		crop := d.objectCrop(compositionObject, objects[i].Width, objects[i].Height)
+		visibleArea := visibleAreas[i]
+		// Translation from object coordinates to video frame coordinates
+		offsetX := compositionObject.ObjectHorizontalPosition - crop.Min.X
+		offsetY := compositionObject.ObjectVerticalPosition - crop.Min.Y
+
+		err = d.rleDecode(ctx, d.objectData(compositionObject.ObjectId), func(x int, y int, paletteIndex int) {
+			if !image.Pt(x, y).In(crop) || !image.Pt(offsetX+x, offsetY+y).In(visibleArea) {
+				return
+			}
+
+			setPixel(offsetX+x-bounds.Min.X, offsetY+y-bounds.Min.Y, paletteIndex)
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("decoding object %d: %w", compositionObject.ObjectId, err)
+		}
 	}
 
 	return &ImageData{
-		Image:  img,
-		Width:  width,
-		Height: height,
+		Image:         img,
+		Width:         width,
+		Height:        height,
+		X:             bounds.Min.X,
+		Y:             bounds.Min.Y,
+		VideoWidth:    d.presentationCompositionSegment.Width,
+		VideoHeight:   d.presentationCompositionSegment.Height,
+		StartTime:     d.StartTime(),
+		EndTime:       d.StartTime(),
+		PaletteUpdate: d.IsPaletteUpdate(),
+		Forced:        forced,
 	}, nil
 }
 
+// newPalettedImage Create an image indexed by palette entry id, filled with the most transparent entry
+func (d *displaySet) newPalettedImage(rectangle image.Rectangle, palette color.Palette) *image.Paletted {
+	transparentIndex := 0
+	_, _, _, transparentAlpha := palette[0].RGBA()
+
+	for i, c := range palette {
+		if _, _, _, alpha := c.RGBA(); alpha < transparentAlpha {
+			transparentIndex = i
+			transparentAlpha = alpha
+		}
+	}
+
+	img := image.NewPaletted(rectangle, palette)
+
+	for i := range img.Pix {
+		img.Pix[i] = uint8(transparentIndex)
+	}
+
+	return img
+}
+
+// canvasBounds Area of the video frame
+func (d *displaySet) canvasBounds() image.Rectangle {
+	return image.Rect(0, 0, d.presentationCompositionSegment.Width, d.presentationCompositionSegment.Height)
+}
+
+func (d *displaySet) window(windowId int) *segment.WindowDefinition {
+	window, ok := d.epoch.windows[windowId]
+
+	if !ok {
+		return nil
+	}
+
+	return &window
+}
+
+// objectCrop Part of the object bitmap that is displayed, in object coordinates
+func (d *displaySet) objectCrop(compositionObject segment.CompositionObject, width int, height int) image.Rectangle {
+	crop := image.Rect(0, 0, width, height)
+
+	if compositionObject.ObjectCroppedFlag {
+		crop = crop.Intersect(image.Rect(
+			compositionObject.ObjectCroppingHorizontalPosition,
+			compositionObject.ObjectCroppingVerticalPosition,
+			compositionObject.ObjectCroppingHorizontalPosition+compositionObject.ObjectCroppingWidth,
+			compositionObject.ObjectCroppingVerticalPosition+compositionObject.ObjectCroppingHeight,
+		))
+	}
+
+	return crop
+}
+
+// objectBounds Area covered by the displayed part of the object, in video frame coordinates
+func (d *displaySet) objectBounds(compositionObject segment.CompositionObject, width int, height int) image.Rectangle {
+	crop := d.objectCrop(compositionObject, width, height)
+
+	return image.Rect(
+		compositionObject.ObjectHorizontalPosition,
+		compositionObject.ObjectVerticalPosition,
+		compositionObject.ObjectHorizontalPosition+crop.Dx(),
+		compositionObject.ObjectVerticalPosition+crop.Dy(),
+	)
+}
+
 func (d *displaySet) StartTime() time.Duration {
-	return d.EndDefinitionSegment.Header.StartTime
+	return d.endDefinitionSegment.Header.StartTime
+}
+
+func (d *displaySet) PresentationCompositionSegment() segment.PresentationCompositionSegment {
+	return d.presentationCompositionSegment
+}
+
+func (d *displaySet) WindowDefinitionSegments() []segment.WindowDefinitionSegment {
+	return d.windowDefinitionSegments
+}
+
+func (d *displaySet) PaletteDefinitionSegments() []segment.PaletteDefinitionSegment {
+	return d.paletteDefinitionSegments
+}
+
+func (d *displaySet) ObjectDefinitionSegments() []segment.ObjectDefinitionSegment {
+	return d.objectDefinitionSegments
+}
+
+func (d *displaySet) EndDefinitionSegment() segment.Segment {
+	return d.endDefinitionSegment
+}
+
+func (d *displaySet) CompositionState() segment.CompositionState {
+	return d.presentationCompositionSegment.CompositionState
+}
+
+// CompositionObjects Objects displayed by this display set.
+// A palette update that doesn't list any object applies to the objects already on screen
+func (d *displaySet) CompositionObjects() []segment.CompositionObject {
+	if d.presentationCompositionSegment.PaletteUpdateFlag && len(d.presentationCompositionSegment.CompositionObjects) == 0 {
+		return d.epoch.compositionObjects
+	}
+	return d.presentationCompositionSegment.CompositionObjects
 }
 
-func (d *displaySet) rleDecode(encodedBuffer buffer.BufferAdapter, callback func(int, int, int)) error {
+func (d *displaySet) IsPaletteUpdate() bool {
+	return d.presentationCompositionSegment.PaletteUpdateFlag
+}
+
+func (d *displaySet) PresentationTimestamp() int {
+	return d.presentationCompositionSegment.Header.PresentationTimestamp
+}
+
+func (d *displaySet) DecodingTimestamp() int {
+	return d.presentationCompositionSegment.Header.DecodingTimestamp
+}
+
+func (d *displaySet) CompositionNumber() int {
+	return d.presentationCompositionSegment.CompositionNumber
+}
+
+func (d *displaySet) Windows() []segment.WindowDefinition {
+	var windows []segment.WindowDefinition
+
+	for _, window := range d.epoch.windows {
+		windows = append(windows, window)
+	}
+
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].WindowId < windows[j].WindowId
+	})
+
+	return windows
+}
+
+func (d *displaySet) Palettes() []segment.PaletteDefinitionSegment {
+	var palettes []segment.PaletteDefinitionSegment
+
+	for _, palette := range d.epoch.palettes {
+		palettes = append(palettes, *palette)
+	}
+
+	sort.Slice(palettes, func(i, j int) bool {
+		return palettes[i].PaletteId < palettes[j].PaletteId
+	})
+
+	return palettes
+}
+
+func (d *displaySet) Palette() (*segment.PaletteDefinitionSegment, error) {
+	pds, err := d.paletteDefinitionSegment(d.presentationCompositionSegment.PaletteId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	palette := *pds
+
+	return &palette, nil
+}
+
+func (d *displaySet) Objects() []Object {
+	var objects []Object
+
+	for _, o := range d.epoch.objects {
+		objects = append(objects, *o)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].ObjectId < objects[j].ObjectId
+	})
+
+	return objects
+}
+
+func (d *displaySet) Object(objectId int) *Object {
+	o := d.object(objectId)
+
+	if o == nil {
+		return nil
+	}
+
+	copied := *o
+
+	return &copied
+}
+
+func (d *displaySet) rleDecode(ctx context.Context, encoded []byte, callback func(int, int, int)) error {
 	encodedIndex := 0
 	decodedLineIndex := 0
 	currentLine := 0
-	encodedLength := encodedBuffer.Length()
+	encodedLength := len(encoded)
 
 	for encodedIndex < encodedLength {
-		firstByte, err := encodedBuffer.At(encodedIndex)
-
-		if err != nil {
-			return err
-		}
+		firstByte := int(encoded[encodedIndex])
 
 		var runLength int
 		var colorB int
@@ -172,12 +549,12 @@ func (d *displaySet) rleDecode(encodedBuffer buffer.BufferAdapter, callback func
 			runLength = 1
 			increment = 1
 		} else {
-			secondByte, err := encodedBuffer.At(encodedIndex + 1)
-
-			if err != nil {
-				return err
+			if encodedIndex+1 >= encodedLength {
+				return ErrTruncatedObjectData
 			}
 
+			secondByte := int(encoded[encodedIndex+1])
+
 			if secondByte == 0 {
 				// 00000000 00000000 - End of line
 				colorB = 0
@@ -185,49 +562,34 @@ func (d *displaySet) rleDecode(encodedBuffer buffer.BufferAdapter, callback func
 				increment = 2
 				decodedLineIndex = 0
 				currentLine++
+
+				// Large objects take a while to decode
+				if err := ctx.Err(); err != nil {
+					return fmt.Errorf("interrupted at line %d: %w", currentLine, err)
+				}
 			} else if secondByte < 64 {
 				// 00000000 00LLLLLL - L pixels in color 0 (L between 1 and 63)
 				colorB = 0
 				runLength = secondByte
 				increment = 2
+			} else if encodedIndex+2 >= encodedLength {
+				return ErrTruncatedObjectData
 			} else if secondByte < 128 {
 				// 00000000 01LLLLLL LLLLLLLL - L pixels in color 0 (L between 64 and 16383)
-				thirdByte, err := encodedBuffer.At(encodedIndex + 2)
-
-				if err != nil {
-					return err
-				}
-
 				colorB = 0
-				runLength = ((secondByte - 64) << 8) + thirdByte
+				runLength = ((secondByte - 64) << 8) + int(encoded[encodedIndex+2])
 				increment = 3
 			} else if secondByte < 192 {
 				// 00000000 10LLLLLL CCCCCCCC - L pixels in color C (L between 3 and 63)
-				thirdByte, err := encodedBuffer.At(encodedIndex + 2)
-
-				if err != nil {
-					return err
-				}
-
-				colorB = thirdByte
+				colorB = int(encoded[encodedIndex+2])
 				runLength = secondByte - 128
 				increment = 3
+			} else if encodedIndex+3 >= encodedLength {
+				return ErrTruncatedObjectData
 			} else {
 				// 00000000 11LLLLLL LLLLLLLL CCCCCCCC - L pixels in color C (L between 64 and 16383)
-				thirdByte, err := encodedBuffer.At(encodedIndex + 2)
-
-				if err != nil {
-					return err
-				}
-
-				fourthByte, err := encodedBuffer.At(encodedIndex + 3)
-
-				if err != nil {
-					return err
-				}
-
-				colorB = fourthByte
-				runLength = ((secondByte - 192) << 8) + thirdByte
+				colorB = int(encoded[encodedIndex+3])
+				runLength = ((secondByte - 192) << 8) + int(encoded[encodedIndex+2])
 				increment = 4
 			}
 		}
@@ -263,26 +625,56 @@ func (d *displaySet) ycrcbToRgba(palette segment.PaletteEntry) color.RGBA {
 	}
 }
 
+// ycrcbToNrgba Convert a palette entry with the given conversion
+func (d *displaySet) ycrcbToNrgba(palette segment.PaletteEntry, conversion ColorConversion) color.NRGBA {
+	y := float64(palette.Luminance)
+	cb := float64(palette.ColorDifferenceBlue)
+	cr := float64(palette.ColorDifferenceRed)
+
+	r, g, b := conversion.toRgb(y, cb, cr)
+
+	// PGS transparency isn't premultiplied
+	return color.NRGBA{
+		R: uint8(d.clamp(math.Round(r), 0, 255)),
+		G: uint8(d.clamp(math.Round(g), 0, 255)),
+		B: uint8(d.clamp(math.Round(b), 0, 255)),
+		A: uint8(palette.Transparency),
+	}
+}
+
 func (d *displaySet) clamp(number float64, min int, max int) int {
 	return int(math.Max(float64(min), math.Min(float64(max), number)))
 }
 
-func (d *displaySet) objectData() []buffer.BufferAdapter {
-	var objectData []buffer.BufferAdapter
+// objectData RLE data of the object, shared with the segment when it isn't fragmented
+func (d *displaySet) objectData(objectId int) []byte {
+	o := d.object(objectId)
 
-	for _, ods := range d.ObjectDefinitionSegments {
-		objectData = append(objectData, ods.ObjectData)
+	if o == nil {
+		return nil
 	}
 
-	return objectData
+	return buffer.NewCompositeBuffer(o.ObjectData).Bytes()
 }
 
+// paletteEntriesToRgba Map each of the 256 palette entry ids to its color, entries that aren't defined are transparent
 func (d *displaySet) paletteEntriesToRgba(entries []segment.PaletteEntry) []color.RGBA {
-	var rgbas []color.RGBA
+	rgbas := make([]color.RGBA, 256)
 
 	for _, palette := range entries {
-		rgbas = append(rgbas, d.ycrcbToRgba(palette))
+		rgbas[palette.PaletteEntryId] = d.ycrcbToRgba(palette)
 	}
 
 	return rgbas
 }
+
+// paletteEntriesToNrgba paletteEntriesToRgba with the given conversion
+func (d *displaySet) paletteEntriesToNrgba(entries []segment.PaletteEntry, conversion ColorConversion) []color.NRGBA {
+	nrgbas := make([]color.NRGBA, 256)
+
+	for _, palette := range entries {
+		nrgbas[palette.PaletteEntryId] = d.ycrcbToNrgba(palette, conversion)
+	}
+
+	return nrgbas
+}
@@ -8,8 +8,6 @@ import (
 	"time"
 )
 
-const pgMagicNumber = 20551 // 0x5047
-
 type DisplaySetParser interface {
 	Next() *DisplaySet
 
@@ -24,6 +22,10 @@ type DisplaySetParser interface {
 	ParsePdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.PaletteDefinitionSegment, error)
 
 	ParseOdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.ObjectDefinitionSegment, error)
+
+	// Resync Discard the display set being parsed, along with the objects, palettes and windows it defined, and resume
+	// with the segment header at the given byte offset, skipping the segments that come before the next PCS
+	Resync(offset int64)
 }
 
 type displaySetParser struct {
@@ -36,6 +38,20 @@ type displaySetParser struct {
 	PaletteDefinitionSegments      []segment.PaletteDefinitionSegment
 	ObjectDefinitionSegments       []segment.ObjectDefinitionSegment
 
+	// epoch Objects, palettes and windows defined since the last epoch start
+	epoch *epoch
+	// committedEpoch State of the epoch at the end of the last complete display set, restored on resync
+	committedEpoch *epoch
+
+	// offset Number of bytes consumed, segmentOffset being the offset of the header of the current segment
+	offset          int64
+	segmentOffset   int64
+	segmentIndex    int
+	displaySetIndex int
+
+	// discarding Whether segments are skipped until the next PCS after a resync
+	discarding bool
+
 	Ready bool
 }
 
@@ -48,6 +64,8 @@ func NewDisplaySetParser() DisplaySetParser {
 		WindowDefinitionSegments:       []segment.WindowDefinitionSegment{},
 		PaletteDefinitionSegments:      []segment.PaletteDefinitionSegment{},
 		ObjectDefinitionSegments:       []segment.ObjectDefinitionSegment{},
+		epoch:                          newEpoch(),
+		committedEpoch:                 newEpoch(),
 		Ready:                          false,
 	}
 }
@@ -62,13 +80,42 @@ func (d *displaySetParser) IsReady() bool {
 }
 
 func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
+	if d.Header == nil {
+		d.segmentOffset = d.offset
+	}
+
+	requestedBytes, err := d.consume(bf)
+
+	if err != nil {
+		var segmentType *segment.SegmentType
+
+		if d.Header != nil {
+			headerSegmentType := d.Header.SegmentType
+			segmentType = &headerSegmentType
+		}
+
+		return 0, d.newParseError(err, segmentType)
+	}
+
+	d.offset += int64(bf.Length())
+
+	return requestedBytes, nil
+}
+
+func (d *displaySetParser) consume(bf buffer.BufferAdapter) (int, error) {
 	reader := buffer.NewBufferReader(bf)
 
+	if d.Header != nil && d.discarding && d.Header.SegmentType != segment.SegmentTypePcs {
+		d.Header = nil
+		d.segmentIndex++
+		return 13, nil
+	}
+
 	if d.Header != nil {
 		switch d.Header.SegmentType {
 		case segment.SegmentTypePcs:
 			if d.PresentationCompositionSegment != nil {
-				return 0, errors.New("unexpected PDS segment")
+				return 0, fmt.Errorf("%w: PCS before the END of the previous display set", ErrUnexpectedSegment)
 			}
 			pcs, err := d.ParsePcsSegment(reader, *d.Header)
 
@@ -76,11 +123,19 @@ func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
 				return 0, err
 			}
 
+			if pcs.CompositionState == segment.CompositionStateEpochStart {
+				// Nothing defined by previous display sets can be referenced anymore
+				d.epoch = newEpoch()
+			}
+
+			d.epoch.setComposition(*pcs)
+
 			d.PresentationCompositionSegment = pcs
+			d.discarding = false
 			break
 		case segment.SegmentTypeWds:
 			if d.WindowDefinitionSegments == nil {
-				return 0, errors.New("unexpected WDS segment")
+				return 0, fmt.Errorf("%w: WDS", ErrUnexpectedSegment)
 			}
 			wds, err := d.ParseWdsSegment(reader, *d.Header)
 
@@ -89,10 +144,11 @@ func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
 			}
 
 			d.WindowDefinitionSegments = append(d.WindowDefinitionSegments, *wds)
+			d.epoch.addWindows(*wds)
 			break
 		case segment.SegmentTypePds:
 			if d.PaletteDefinitionSegments == nil {
-				return 0, errors.New("unexpected PDS segment")
+				return 0, fmt.Errorf("%w: PDS", ErrUnexpectedSegment)
 			}
 			pds, err := d.ParsePdsSegment(reader, *d.Header)
 
@@ -101,10 +157,11 @@ func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
 			}
 
 			d.PaletteDefinitionSegments = append(d.PaletteDefinitionSegments, *pds)
+			d.epoch.addPalette(*pds)
 			break
 		case segment.SegmentTypeOds:
 			if d.ObjectDefinitionSegments == nil {
-				return 0, errors.New("unexpected ODS segment")
+				return 0, fmt.Errorf("%w: ODS", ErrUnexpectedSegment)
 			}
 			ods, err := d.ParseOdsSegment(reader, *d.Header)
 
@@ -112,27 +169,34 @@ func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
 				return 0, err
 			}
 
+			if !d.epoch.addObjectFragment(*ods) {
+				return 0, fmt.Errorf("%w for object %d", ErrUnexpectedObjectFragment, ods.ObjectId)
+			}
+
 			d.ObjectDefinitionSegments = append(d.ObjectDefinitionSegments, *ods)
 			break
 		case segment.SegmentTypeEnd:
 			if d.PresentationCompositionSegment == nil {
-				return 0, errors.New("unexpected END segment")
+				return 0, fmt.Errorf("%w: END without PCS", ErrUnexpectedSegment)
 			}
 
 			endDefinitionSegment := segment.Segment{
 				Header: *d.Header,
 			}
 
-			lastDisplaySet := NewDisplaySet(
+			d.committedEpoch = d.epoch.snapshot()
+
+			lastDisplaySet := newDisplaySet(
 				*d.PresentationCompositionSegment,
 				d.WindowDefinitionSegments,
 				d.PaletteDefinitionSegments,
 				d.ObjectDefinitionSegments,
 				endDefinitionSegment,
-				d.LastDisplaySet,
+				d.committedEpoch,
 			)
 
 			d.LastDisplaySet = &lastDisplaySet
+			d.displaySetIndex++
 
 			d.Ready = true
 			d.PresentationCompositionSegment = nil
@@ -142,10 +206,11 @@ func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
 			break
 
 		default:
-			return 0, fmt.Errorf("unknown segment type %d", d.Header.SegmentType)
+			return 0, fmt.Errorf("%w: %d", segment.ErrInvalidSegmentType, d.Header.SegmentType)
 		}
 
 		d.Header = nil
+		d.segmentIndex++
 		return 13, nil
 	} else {
 		magicNumber, err := reader.ReadBytes(2)
@@ -154,8 +219,8 @@ func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
 			return 0, err
 		}
 
-		if magicNumber != pgMagicNumber {
-			return 0, fmt.Errorf("invalid magic number %d", magicNumber)
+		if magicNumber != segment.PgMagicNumber {
+			return 0, fmt.Errorf("%w: %d", ErrInvalidMagicNumber, magicNumber)
 		}
 
 		presentationTimestamp, err := reader.ReadBytes(4)
@@ -203,6 +268,16 @@ func (d *displaySetParser) Consume(bf buffer.BufferAdapter) (int, error) {
 }
 
 func (d *displaySetParser) ParsePcsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.PresentationCompositionSegment, error) {
+	parsed, err := d.parsePcsSegment(reader, header)
+
+	if err != nil {
+		return nil, d.newParseError(err, &header.SegmentType)
+	}
+
+	return parsed, nil
+}
+
+func (d *displaySetParser) parsePcsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.PresentationCompositionSegment, error) {
 	limit := reader.Index() + header.SegmentSize
 	width, err := reader.ReadBytesWithLimit(2, &limit)
 
@@ -216,7 +291,7 @@ func (d *displaySetParser) ParsePcsSegment(reader buffer.BufferReader, header se
 		return nil, err
 	}
 
-	_, err = reader.ReadBytes(1) // ignore frame rate
+	frameRate, err := reader.ReadBytesWithLimit(1, &limit)
 
 	if err != nil {
 		return nil, err
@@ -264,85 +339,123 @@ func (d *displaySetParser) ParsePcsSegment(reader buffer.BufferReader, header se
 		return nil, err
 	}
 
-	objectId, err := reader.ReadBytesWithLimit(2, &limit)
+	var compositionObjects []segment.CompositionObject
+
+	for i := 0; i < compositionObjectCount; i++ {
+		compositionObject, err := d.parseCompositionObject(reader, &limit)
+
+		if err != nil {
+			return nil, err
+		}
+
+		compositionObjects = append(compositionObjects, *compositionObject)
+	}
+
+	return &segment.PresentationCompositionSegment{
+		Width:                  width,
+		Height:                 height,
+		FrameRate:              frameRate,
+		CompositionNumber:      compositionNumber,
+		CompositionState:       compositionState,
+		PaletteUpdateFlag:      paletteUpdateFlag,
+		PaletteId:              paletteId,
+		CompositionObjectCount: compositionObjectCount,
+		CompositionObjects:     compositionObjects,
+		Segment: segment.Segment{
+			Header: header,
+		},
+	}, nil
+}
+
+func (d *displaySetParser) parseCompositionObject(reader buffer.BufferReader, limit *int) (*segment.CompositionObject, error) {
+	objectId, err := reader.ReadBytesWithLimit(2, limit)
 
 	if err != nil {
 		return nil, err
 	}
 
-	windowId, err := reader.ReadBytesWithLimit(1, &limit)
+	windowId, err := reader.ReadBytesWithLimit(1, limit)
 
 	if err != nil {
 		return nil, err
 	}
 
-	objectCroppedFlagByte, err := reader.ReadBytesWithLimit(1, &limit)
+	objectFlagsByte, err := reader.ReadBytesWithLimit(1, limit)
 
 	if err != nil {
 		return nil, err
 	}
 
-	objectCroppedFlag, err := d.SegmentMapper.ToObjectCroppedFlag(byte(objectCroppedFlagByte))
+	objectCroppedFlag, objectForcedOnFlag, err := d.SegmentMapper.ToObjectFlags(byte(objectFlagsByte))
 
 	if err != nil {
 		return nil, err
 	}
 
-	objectHorizontalPosition, err := reader.ReadBytesWithLimit(2, &limit)
+	objectHorizontalPosition, err := reader.ReadBytesWithLimit(2, limit)
 
 	if err != nil {
 		return nil, err
 	}
-	objectVerticalPosition, err := reader.ReadBytesWithLimit(2, &limit)
+
+	objectVerticalPosition, err := reader.ReadBytesWithLimit(2, limit)
 
 	if err != nil {
 		return nil, err
 	}
-	objectCroppingHorizontalPosition, err := reader.ReadBytesWithLimit(2, &limit)
+
+	compositionObject := &segment.CompositionObject{
+		ObjectId:                 objectId,
+		WindowId:                 windowId,
+		ObjectCroppedFlag:        objectCroppedFlag,
+		ObjectForcedOnFlag:       objectForcedOnFlag,
+		ObjectHorizontalPosition: objectHorizontalPosition,
+		ObjectVerticalPosition:   objectVerticalPosition,
+	}
+
+	if !objectCroppedFlag {
+		// Cropping fields are only present for cropped objects
+		return compositionObject, nil
+	}
+
+	compositionObject.ObjectCroppingHorizontalPosition, err = reader.ReadBytesWithLimit(2, limit)
 
 	if err != nil {
 		return nil, err
 	}
-	objectCroppingVerticalPosition, err := reader.ReadBytesWithLimit(2, &limit)
+
+	compositionObject.ObjectCroppingVerticalPosition, err = reader.ReadBytesWithLimit(2, limit)
 
 	if err != nil {
 		return nil, err
 	}
-	objectCroppingWidth, err := reader.ReadBytesWithLimit(2, &limit)
+
+	compositionObject.ObjectCroppingWidth, err = reader.ReadBytesWithLimit(2, limit)
 
 	if err != nil {
 		return nil, err
 	}
-	objectCroppingHeightPosition, err := reader.ReadBytesWithLimit(2, &limit)
+
+	compositionObject.ObjectCroppingHeight, err = reader.ReadBytesWithLimit(2, limit)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &segment.PresentationCompositionSegment{
-		Width:                            width,
-		Height:                           height,
-		CompositionNumber:                compositionNumber,
-		CompositionState:                 compositionState,
-		PaletteUpdateFlag:                paletteUpdateFlag,
-		PaletteId:                        paletteId,
-		CompositionObjectCount:           compositionObjectCount,
-		ObjectId:                         objectId,
-		WindowId:                         windowId,
-		ObjectCroppedFlag:                objectCroppedFlag,
-		ObjectHorizontalPosition:         objectHorizontalPosition,
-		ObjectVerticalPosition:           objectVerticalPosition,
-		ObjectCroppingHorizontalPosition: objectCroppingHorizontalPosition,
-		ObjectCroppingVerticalPosition:   objectCroppingVerticalPosition,
-		ObjectCroppingWidth:              objectCroppingWidth,
-		ObjectCroppingHeight:             objectCroppingHeightPosition,
-		Segment: segment.Segment{
-			Header: header,
-		},
-	}, nil
+	return compositionObject, nil
 }
 
 func (d *displaySetParser) ParseWdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.WindowDefinitionSegment, error) {
+	parsed, err := d.parseWdsSegment(reader, header)
+
+	if err != nil {
+		return nil, d.newParseError(err, &header.SegmentType)
+	}
+
+	return parsed, nil
+}
+
+func (d *displaySetParser) parseWdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.WindowDefinitionSegment, error) {
 	limit := reader.Index() + header.SegmentSize
 	windowCount, err := reader.ReadBytesWithLimit(1, &limit)
 
@@ -398,6 +511,16 @@ func (d *displaySetParser) ParseWdsSegment(reader buffer.BufferReader, header se
 }
 
 func (d *displaySetParser) ParsePdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.PaletteDefinitionSegment, error) {
+	parsed, err := d.parsePdsSegment(reader, header)
+
+	if err != nil {
+		return nil, d.newParseError(err, &header.SegmentType)
+	}
+
+	return parsed, nil
+}
+
+func (d *displaySetParser) parsePdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.PaletteDefinitionSegment, error) {
 	limit := reader.Index() + header.SegmentSize
 	paletteId, err := reader.ReadBytesWithLimit(1, &limit)
 
@@ -456,19 +579,30 @@ func (d *displaySetParser) ParsePdsSegment(reader buffer.BufferReader, header se
 }
 
 func (d *displaySetParser) ParseOdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.ObjectDefinitionSegment, error) {
-	objectId, err := reader.ReadBytes(2)
+	parsed, err := d.parseOdsSegment(reader, header)
+
+	if err != nil {
+		return nil, d.newParseError(err, &header.SegmentType)
+	}
+
+	return parsed, nil
+}
+
+func (d *displaySetParser) parseOdsSegment(reader buffer.BufferReader, header segment.SegmentHeader) (*segment.ObjectDefinitionSegment, error) {
+	limit := reader.Index() + header.SegmentSize
+	objectId, err := reader.ReadBytesWithLimit(2, &limit)
 
 	if err != nil {
 		return nil, err
 	}
 
-	objectVersionNumber, err := reader.ReadBytes(1)
+	objectVersionNumber, err := reader.ReadBytesWithLimit(1, &limit)
 
 	if err != nil {
 		return nil, err
 	}
 
-	lastInSequenceFlagByte, err := reader.ReadBytes(1)
+	lastInSequenceFlagByte, err := reader.ReadBytesWithLimit(1, &limit)
 
 	if err != nil {
 		return nil, err
@@ -480,20 +614,26 @@ func (d *displaySetParser) ParseOdsSegment(reader buffer.BufferReader, header se
 		return nil, err
 	}
 
-	objectDataLength, err := reader.ReadBytes(3)
-
+	objectDataLength := 0
 	var width *int = nil
 	var height *int = nil
 	var objectData buffer.BufferAdapter
 
 	if lastInSequenceFlag == segment.LastInSequenceFlagFirstInSequence || lastInSequenceFlag == segment.LastInSequenceFlagFirstAndLastInSequence {
-		w, e := reader.ReadBytes(2)
+		// Object data length, width and height are only defined by the first fragment of an object
+		objectDataLength, err = reader.ReadBytesWithLimit(3, &limit)
+
+		if err != nil {
+			return nil, err
+		}
+
+		w, e := reader.ReadBytesWithLimit(2, &limit)
 
 		if e != nil {
 			return nil, e
 		}
 
-		h, e := reader.ReadBytes(2)
+		h, e := reader.ReadBytesWithLimit(2, &limit)
 
 		if e != nil {
 			return nil, e
@@ -501,11 +641,11 @@ func (d *displaySetParser) ParseOdsSegment(reader buffer.BufferReader, header se
 
 		width = &w
 		height = &h
-		objectData = reader.ReadBuffer(objectDataLength - 4)
-	} else {
-		objectData = reader.ReadBuffer(objectDataLength)
 	}
 
+	// Object data of a fragmented object continues in the next ODS
+	objectData = reader.ReadBuffer(limit - reader.Index())
+
 	return &segment.ObjectDefinitionSegment{
 		ObjectId:            objectId,
 		ObjectVersionNumber: objectVersionNumber,
@@ -520,3 +660,32 @@ func (d *displaySetParser) ParseOdsSegment(reader buffer.BufferReader, header se
 		},
 	}, nil
 }
+
+func (d *displaySetParser) Resync(offset int64) {
+	d.offset = offset
+	d.Header = nil
+	d.PresentationCompositionSegment = nil
+	d.WindowDefinitionSegments = []segment.WindowDefinitionSegment{}
+	d.PaletteDefinitionSegments = []segment.PaletteDefinitionSegment{}
+	d.ObjectDefinitionSegments = []segment.ObjectDefinitionSegment{}
+	// Forget what the discarded display set defined
+	d.epoch = d.committedEpoch.snapshot()
+	d.discarding = true
+}
+
+// newParseError Wrap an error with the position of the current segment, unless it's already wrapped
+func (d *displaySetParser) newParseError(err error, segmentType *segment.SegmentType) error {
+	var parseError *ParseError
+
+	if errors.As(err, &parseError) {
+		return err
+	}
+
+	return &ParseError{
+		Offset:          d.segmentOffset,
+		SegmentIndex:    d.segmentIndex,
+		SegmentType:     segmentType,
+		DisplaySetIndex: d.displaySetIndex,
+		Err:             err,
+	}
+}
@@ -0,0 +1,167 @@
+package displaySet
+
+import (
+	"errors"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"testing"
+)
+
+// testPcsPayload PCS of a 1920x1080 video followed by the given composition objects
+func testPcsPayload(compositionState byte, compositionObjects ...[]byte) []byte {
+	pcs := []byte{0x07, 0x80, 0x04, 0x38, 0x10, 0, 0, compositionState, 0, 0, byte(len(compositionObjects))}
+
+	for _, compositionObject := range compositionObjects {
+		pcs = append(pcs, compositionObject...)
+	}
+
+	return pcs
+}
+
+// testCompositionObject Composition object with the given flags byte, followed by the cropping rectangle if any
+func testCompositionObject(objectId int, windowId int, flags byte, x int, y int, crop ...int) []byte {
+	compositionObject := []byte{byte(objectId >> 8), byte(objectId), byte(windowId), flags, byte(x >> 8), byte(x), byte(y >> 8), byte(y)}
+
+	for _, value := range crop {
+		compositionObject = append(compositionObject, byte(value>>8), byte(value))
+	}
+
+	return compositionObject
+}
+
+func parsePcs(t *testing.T, payload []byte) *segment.PresentationCompositionSegment {
+	t.Helper()
+
+	reader := buffer.NewBufferReader(buffer.NewUint8ArrayBuffer(payload))
+	pcs, err := NewDisplaySetParser().ParsePcsSegment(reader, segment.SegmentHeader{
+		SegmentType: segment.SegmentTypePcs,
+		SegmentSize: len(payload),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reader.Index() != len(payload) {
+		t.Fatalf("expected the %d bytes of the PCS to be read, got %d", len(payload), reader.Index())
+	}
+
+	return pcs
+}
+
+func TestParseCroppedCompositionObject(t *testing.T) {
+	cropped := segment.CompositionObject{
+		ObjectId:                         1,
+		WindowId:                         0,
+		ObjectCroppedFlag:                true,
+		ObjectHorizontalPosition:         100,
+		ObjectVerticalPosition:           900,
+		ObjectCroppingHorizontalPosition: 10,
+		ObjectCroppingVerticalPosition:   20,
+		ObjectCroppingWidth:              300,
+		ObjectCroppingHeight:             40,
+	}
+	uncropped := segment.CompositionObject{
+		ObjectId:                 2,
+		WindowId:                 1,
+		ObjectHorizontalPosition: 200,
+		ObjectVerticalPosition:   950,
+	}
+
+	testCases := []struct {
+		name               string
+		compositionObjects [][]byte
+		expected           []segment.CompositionObject
+	}{
+		{
+			name: "cropped object first",
+			compositionObjects: [][]byte{
+				testCompositionObject(1, 0, 0x80, 100, 900, 10, 20, 300, 40),
+				testCompositionObject(2, 1, 0x00, 200, 950),
+			},
+			expected: []segment.CompositionObject{cropped, uncropped},
+		},
+		{
+			name: "cropped object last",
+			compositionObjects: [][]byte{
+				testCompositionObject(2, 1, 0x00, 200, 950),
+				testCompositionObject(1, 0, 0x80, 100, 900, 10, 20, 300, 40),
+			},
+			expected: []segment.CompositionObject{uncropped, cropped},
+		},
+	}
+
+	for _, testCase := range testCases {
+		pcs := parsePcs(t, testPcsPayload(0x80, testCase.compositionObjects...))
+
+		if len(pcs.CompositionObjects) != len(testCase.expected) {
+			t.Fatalf("%s: expected %d composition objects, got %d", testCase.name, len(testCase.expected), len(pcs.CompositionObjects))
+		}
+
+		for i, expected := range testCase.expected {
+			if got := pcs.CompositionObjects[i]; got != expected {
+				t.Fatalf("%s: expected composition object %d to be %+v, got %+v", testCase.name, i, expected, got)
+			}
+		}
+	}
+}
+
+func TestParseInvalidCompositionObjectFlags(t *testing.T) {
+	payload := testPcsPayload(0x80, testCompositionObject(1, 0, 0x01, 100, 900))
+	reader := buffer.NewBufferReader(buffer.NewUint8ArrayBuffer(payload))
+
+	_, err := NewDisplaySetParser().ParsePcsSegment(reader, segment.SegmentHeader{
+		SegmentType: segment.SegmentTypePcs,
+		SegmentSize: len(payload),
+	})
+
+	if !errors.Is(err, segment.ErrInvalidObjectFlags) {
+		t.Fatalf("expected %v for reserved bits set in the composition object flags, got %v", segment.ErrInvalidObjectFlags, err)
+	}
+}
+
+func TestParseForcedCompositionObject(t *testing.T) {
+	pcs := parsePcs(t, testPcsPayload(0x80,
+		testCompositionObject(1, 0, 0x40, 100, 900),
+		testCompositionObject(2, 0, 0xC0, 200, 950, 10, 20, 300, 40),
+		testCompositionObject(3, 1, 0x00, 300, 1000),
+	))
+
+	expected := []segment.CompositionObject{
+		{
+			ObjectId:                 1,
+			WindowId:                 0,
+			ObjectForcedOnFlag:       true,
+			ObjectHorizontalPosition: 100,
+			ObjectVerticalPosition:   900,
+		},
+		{
+			ObjectId:                         2,
+			WindowId:                         0,
+			ObjectCroppedFlag:                true,
+			ObjectForcedOnFlag:               true,
+			ObjectHorizontalPosition:         200,
+			ObjectVerticalPosition:           950,
+			ObjectCroppingHorizontalPosition: 10,
+			ObjectCroppingVerticalPosition:   20,
+			ObjectCroppingWidth:              300,
+			ObjectCroppingHeight:             40,
+		},
+		{
+			ObjectId:                 3,
+			WindowId:                 1,
+			ObjectHorizontalPosition: 300,
+			ObjectVerticalPosition:   1000,
+		},
+	}
+
+	if len(pcs.CompositionObjects) != len(expected) {
+		t.Fatalf("expected %d composition objects, got %d", len(expected), len(pcs.CompositionObjects))
+	}
+
+	for i := range expected {
+		if pcs.CompositionObjects[i] != expected[i] {
+			t.Fatalf("expected composition object %d to be %+v, got %+v", i, expected[i], pcs.CompositionObjects[i])
+		}
+	}
+}
@@ -0,0 +1,658 @@
+package displaySet
+
+import (
+	"context"
+	"errors"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+var (
+	testLight       = color.RGBA{R: 235, G: 235, B: 235, A: 255}
+	testDark        = color.RGBA{R: 16, G: 16, B: 16, A: 255}
+	testTransparent = color.RGBA{}
+)
+
+// testSegment Segment presented at the given second
+func testSegment(second int, segmentType byte, payload []byte) []byte {
+	timestamp := second * 90000
+	data := []byte{'P', 'G', byte(timestamp >> 24), byte(timestamp >> 16), byte(timestamp >> 8), byte(timestamp), 0, 0, 0, 0, segmentType, byte(len(payload) >> 8), byte(len(payload))}
+
+	return append(data, payload...)
+}
+
+// testWdsPayload WDS defining windows given as id, x, y, width and height
+func testWdsPayload(windows ...[5]int) []byte {
+	wds := []byte{byte(len(windows))}
+
+	for _, window := range windows {
+		wds = append(wds, byte(window[0]))
+
+		for _, value := range window[1:] {
+			wds = append(wds, byte(value>>8), byte(value))
+		}
+	}
+
+	return wds
+}
+
+// testPdsPayload PDS of palette 0 with entry 1 light and entry 2 dark, both opaque, unless other entries are given as
+// id, Y, Cr, Cb and alpha
+func testPdsPayload(version byte, entries ...[5]byte) []byte {
+	if len(entries) == 0 {
+		entries = [][5]byte{{1, 235, 128, 128, 255}, {2, 16, 128, 128, 255}}
+	}
+
+	pds := []byte{0, version}
+
+	for _, entry := range entries {
+		pds = append(pds, entry[:]...)
+	}
+
+	return pds
+}
+
+// testOdsPayloads Object split into the given number of ODS fragments
+func testOdsPayloads(objectId int, img *image.Paletted, fragments int) [][]byte {
+	rle := RleEncode(img)
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	fragmentLength := (len(rle) + fragments - 1) / fragments
+
+	var payloads [][]byte
+
+	for i := 0; i < fragments; i++ {
+		sequenceFlag := byte(0)
+
+		if i == 0 {
+			sequenceFlag |= 0x80
+		}
+
+		if i == fragments-1 {
+			sequenceFlag |= 0x40
+		}
+
+		ods := []byte{byte(objectId >> 8), byte(objectId), 0, sequenceFlag}
+
+		if i == 0 {
+			ods = append(ods, byte((len(rle)+4)>>16), byte((len(rle)+4)>>8), byte(len(rle)+4), byte(width>>8), byte(width), byte(height>>8), byte(height))
+		}
+
+		end := (i + 1) * fragmentLength
+
+		if end > len(rle) {
+			end = len(rle)
+		}
+
+		payloads = append(payloads, append(ods, rle[i*fragmentLength:end]...))
+	}
+
+	return payloads
+}
+
+// parseDisplaySets Feed the stream to a DisplaySetParser one segment header or payload at a time
+func parseDisplaySets(t *testing.T, data []byte) []DisplaySet {
+	t.Helper()
+
+	parser := NewDisplaySetParser()
+	// Segment header length
+	requestedBytes := 13
+	readingHeader := true
+	var displaySets []DisplaySet
+
+	for len(data) > 0 || !readingHeader {
+		if requestedBytes > len(data) {
+			t.Fatalf("expected %d more bytes, got %d", requestedBytes, len(data))
+		}
+
+		chunk := data[:requestedBytes]
+		data = data[requestedBytes:]
+
+		var err error
+		requestedBytes, err = parser.Consume(buffer.NewUint8ArrayBuffer(chunk))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readingHeader = !readingHeader
+
+		if parser.IsReady() {
+			displaySets = append(displaySets, *parser.Next())
+		}
+	}
+
+	return displaySets
+}
+
+// renderPixels Render the display set, failing if nothing is displayed
+func renderPixels(t *testing.T, set DisplaySet, options RenderOptions) *ImageData {
+	t.Helper()
+
+	data, err := set.ToImageDataWithOptions(options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data == nil {
+		t.Fatal("expected an image, got nothing displayed")
+	}
+
+	return data
+}
+
+// expectPixel Fail if the pixel of the image at the given video frame coordinates isn't the expected color
+func expectPixel(t *testing.T, data *ImageData, x int, y int, expected color.Color) {
+	t.Helper()
+
+	if got := data.Image.At(x-data.X, y-data.Y); !sameColor(got, expected) {
+		t.Errorf("expected %v at %d,%d, got %v", expected, x, y, got)
+	}
+}
+
+func sameColor(a color.Color, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func TestRenderObjectsOfSeveralWindows(t *testing.T) {
+	// Light left half and dark right half
+	first := newBitmap(20, 10, func(x int, y int) byte {
+		if x < 10 {
+			return 1
+		}
+
+		return 2
+	})
+	// Dark top half and light bottom half, defined by several ODS
+	second := newBitmap(30, 8, func(x int, y int) byte {
+		if y < 4 {
+			return 2
+		}
+
+		return 1
+	})
+
+	var data []byte
+
+	data = append(data, testSegment(1, 0x16, testPcsPayload(0x80,
+		testCompositionObject(0, 0, 0x00, 100, 900),
+		testCompositionObject(1, 1, 0x00, 1000, 950),
+	))...)
+	data = append(data, testSegment(1, 0x17, testWdsPayload([5]int{0, 100, 900, 20, 10}, [5]int{1, 1000, 950, 30, 8}))...)
+	data = append(data, testSegment(1, 0x14, testPdsPayload(0))...)
+
+	for _, objectId := range []int{0, 1} {
+		img, fragments := first, 1
+
+		if objectId == 1 {
+			img, fragments = second, 3
+		}
+
+		for _, ods := range testOdsPayloads(objectId, img, fragments) {
+			data = append(data, testSegment(1, 0x15, ods)...)
+		}
+	}
+
+	data = append(data, testSegment(1, 0x80, nil)...)
+
+	displaySets := parseDisplaySets(t, data)
+
+	if len(displaySets) != 1 {
+		t.Fatalf("expected 1 display set, got %d", len(displaySets))
+	}
+
+	set := displaySets[0]
+	expected := []segment.CompositionObject{
+		{ObjectId: 0, WindowId: 0, ObjectHorizontalPosition: 100, ObjectVerticalPosition: 900},
+		{ObjectId: 1, WindowId: 1, ObjectHorizontalPosition: 1000, ObjectVerticalPosition: 950},
+	}
+
+	if len(set.CompositionObjects()) != len(expected) {
+		t.Fatalf("expected %d composition objects, got %d", len(expected), len(set.CompositionObjects()))
+	}
+
+	for i := range expected {
+		if got := set.CompositionObjects()[i]; got != expected[i] {
+			t.Fatalf("expected composition object %d to be %+v, got %+v", i, expected[i], got)
+		}
+	}
+
+	if count := len(set.ObjectDefinitionSegments()); count != 4 {
+		t.Fatalf("expected 4 ODS, got %d", count)
+	}
+
+	rendered := renderPixels(t, set, RenderOptions{})
+
+	if rendered.X != 100 || rendered.Y != 900 || rendered.Width != 930 || rendered.Height != 58 {
+		t.Fatalf("expected an image of 930x58 at 100,900, got %dx%d at %d,%d", rendered.Width, rendered.Height, rendered.X, rendered.Y)
+	}
+
+	expectPixel(t, rendered, 100, 900, testLight)
+	expectPixel(t, rendered, 119, 909, testDark)
+	expectPixel(t, rendered, 1000, 950, testDark)
+	expectPixel(t, rendered, 1029, 957, testLight)
+	// Between the objects
+	expectPixel(t, rendered, 500, 930, testTransparent)
+}
+
+// benchmarkBitmap Subtitle sized bitmap mixing single pixels and runs
+func benchmarkBitmap() []byte {
+	random := rand.New(rand.NewSource(1))
+	var previous byte
+
+	return RleEncode(newBitmap(1920, 200, func(x int, y int) byte {
+		if random.Intn(4) == 0 {
+			previous = byte(random.Intn(4))
+		}
+
+		return previous
+	}))
+}
+
+// benchmarkFragments RLE data split into ODS sized fragments
+func benchmarkFragments(encoded []byte) []buffer.BufferAdapter {
+	var fragments []buffer.BufferAdapter
+
+	for len(encoded) > 0 {
+		length := 65524
+
+		if length > len(encoded) {
+			length = len(encoded)
+		}
+
+		fragments = append(fragments, buffer.NewUint8ArrayBuffer(encoded[:length]))
+		encoded = encoded[length:]
+	}
+
+	return fragments
+}
+
+// baselineRleDecode RLE decoder reading each byte through BufferAdapter.At, as objects were decoded before they were
+// read from contiguous byte slices. Kept to compare with rleDecode
+func baselineRleDecode(encoded buffer.BufferAdapter, callback func(int, int, int)) error {
+	encodedIndex := 0
+	decodedLineIndex := 0
+	currentLine := 0
+
+	for encodedIndex < encoded.Length() {
+		firstByte, err := encoded.At(encodedIndex)
+
+		if err != nil {
+			return err
+		}
+
+		runLength, colorB, increment := 1, firstByte, 1
+
+		if firstByte == 0 {
+			secondByte, err := encoded.At(encodedIndex + 1)
+
+			if err != nil {
+				return err
+			}
+
+			thirdByte, fourthByte := 0, 0
+
+			if secondByte >= 64 {
+				thirdByte, err = encoded.At(encodedIndex + 2)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			if secondByte >= 192 {
+				fourthByte, err = encoded.At(encodedIndex + 3)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			if secondByte == 0 {
+				runLength, colorB, increment = 0, 0, 2
+				decodedLineIndex = 0
+				currentLine++
+			} else if secondByte < 64 {
+				runLength, colorB, increment = secondByte, 0, 2
+			} else if secondByte < 128 {
+				runLength, colorB, increment = ((secondByte-64)<<8)+thirdByte, 0, 3
+			} else if secondByte < 192 {
+				runLength, colorB, increment = secondByte-128, thirdByte, 3
+			} else {
+				runLength, colorB, increment = ((secondByte-192)<<8)+thirdByte, fourthByte, 4
+			}
+		}
+
+		for x := decodedLineIndex; x < decodedLineIndex+runLength; x++ {
+			callback(x, currentLine, colorB)
+		}
+
+		decodedLineIndex += runLength
+		encodedIndex += increment
+	}
+
+	return nil
+}
+
+func BenchmarkRleDecode(b *testing.B) {
+	encoded := benchmarkBitmap()
+	set := &displaySet{}
+	ctx := context.Background()
+
+	b.SetBytes(int64(len(encoded)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := set.rleDecode(ctx, encoded, func(x int, y int, paletteIndex int) {})
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRleDecodeFragmentedObject(b *testing.B) {
+	encoded := benchmarkBitmap()
+	fragments := benchmarkFragments(encoded)
+	set := &displaySet{}
+	ctx := context.Background()
+
+	b.SetBytes(int64(len(encoded)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// Fragments are concatenated before decoding, as done by objectData
+		err := set.rleDecode(ctx, buffer.NewCompositeBuffer(fragments).Bytes(), func(x int, y int, paletteIndex int) {})
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBaselineRleDecodeFragmentedObject(b *testing.B) {
+	encoded := benchmarkBitmap()
+	fragments := benchmarkFragments(encoded)
+
+	b.SetBytes(int64(len(encoded)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := baselineRleDecode(buffer.NewCompositeBuffer(fragments), func(x int, y int, paletteIndex int) {})
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBaselineRleDecodeMatchesRleDecode(t *testing.T) {
+	encoded := benchmarkBitmap()
+	var expected, got []int
+
+	err := (&displaySet{}).rleDecode(context.Background(), encoded, func(x int, y int, paletteIndex int) {
+		expected = append(expected, x, y, paletteIndex)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = baselineRleDecode(buffer.NewCompositeBuffer(benchmarkFragments(encoded)), func(x int, y int, paletteIndex int) {
+		got = append(got, x, y, paletteIndex)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d decoded pixels, got %d", len(expected)/3, len(got)/3)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected pixel %d to be decoded as %v, got %v", i/3, expected[i/3*3:i/3*3+3], got[i/3*3:i/3*3+3])
+		}
+	}
+}
+
+func TestRenderFullCanvasClippedToWindow(t *testing.T) {
+	// Light object, half of which is outside its window
+	var data []byte
+
+	data = append(data, testSegment(1, 0x16, testPcsPayload(0x80, testCompositionObject(0, 0, 0x00, 100, 900)))...)
+	data = append(data, testSegment(1, 0x17, testWdsPayload([5]int{0, 110, 900, 20, 10}))...)
+	data = append(data, testSegment(1, 0x14, testPdsPayload(0))...)
+	data = append(data, testSegment(1, 0x15, testOdsPayloads(0, newBitmap(20, 10, func(x int, y int) byte {
+		return 1
+	}), 1)[0])...)
+	data = append(data, testSegment(1, 0x80, nil)...)
+
+	set := parseDisplaySets(t, data)[0]
+
+	testCases := []struct {
+		name       string
+		options    RenderOptions
+		bounds     image.Rectangle
+		imageWidth int
+	}{
+		{"cropped to the window", RenderOptions{}, image.Rect(110, 900, 120, 910), 10},
+		{"full canvas", RenderOptions{FullCanvas: true}, image.Rect(0, 0, 1920, 1080), 1920},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rendered := renderPixels(t, set, testCase.options)
+			bounds := image.Rect(rendered.X, rendered.Y, rendered.X+rendered.Width, rendered.Y+rendered.Height)
+
+			if bounds != testCase.bounds || rendered.Image.Bounds().Dx() != testCase.imageWidth {
+				t.Fatalf("expected an image covering %v, got %v with an image %d pixels wide", testCase.bounds, bounds, rendered.Image.Bounds().Dx())
+			}
+
+			expectPixel(t, rendered, 110, 900, testLight)
+			expectPixel(t, rendered, 119, 909, testLight)
+
+			if testCase.options.FullCanvas {
+				// Parts of the object outside of the window
+				expectPixel(t, rendered, 100, 900, testTransparent)
+				expectPixel(t, rendered, 109, 909, testTransparent)
+				expectPixel(t, rendered, 0, 0, testTransparent)
+			}
+		})
+	}
+}
+
+func TestRenderWithDefinitionsOfPreviousDisplaySets(t *testing.T) {
+	shown := testCompositionObject(0, 0, 0x00, 100, 900)
+	var data []byte
+
+	// Epoch start defining everything
+	data = append(data, testSegment(1, 0x16, testPcsPayload(0x80, shown))...)
+	data = append(data, testSegment(1, 0x17, testWdsPayload([5]int{0, 100, 900, 20, 10}))...)
+	data = append(data, testSegment(1, 0x14, testPdsPayload(0))...)
+	data = append(data, testSegment(1, 0x15, testOdsPayloads(0, newBitmap(20, 10, func(x int, y int) byte {
+		return 1
+	}), 1)[0])...)
+	data = append(data, testSegment(1, 0x80, nil)...)
+	// Shows the object again with the palette of the epoch start
+	data = append(data, testSegment(2, 0x16, testPcsPayload(0x00, shown))...)
+	data = append(data, testSegment(2, 0x80, nil)...)
+	// Redefines palette entry 1 as dark, the object being reused
+	data = append(data, testSegment(3, 0x16, testPcsPayload(0x00, shown))...)
+	data = append(data, testSegment(3, 0x14, testPdsPayload(1, [5]byte{1, 16, 128, 128, 255}))...)
+	data = append(data, testSegment(3, 0x80, nil)...)
+	// A new epoch can't reference what the previous one defined
+	data = append(data, testSegment(4, 0x16, testPcsPayload(0x80, shown))...)
+	data = append(data, testSegment(4, 0x80, nil)...)
+
+	displaySets := parseDisplaySets(t, data)
+
+	if len(displaySets) != 4 {
+		t.Fatalf("expected 4 display sets, got %d", len(displaySets))
+	}
+
+	for i, expected := range []color.Color{testLight, testLight, testDark} {
+		rendered := renderPixels(t, displaySets[i], RenderOptions{})
+
+		if rendered.X != 100 || rendered.Y != 900 || rendered.Width != 20 || rendered.Height != 10 {
+			t.Fatalf("display set %d: expected an image of 20x10 at 100,900, got %dx%d at %d,%d", i, rendered.Width, rendered.Height, rendered.X, rendered.Y)
+		}
+
+		expectPixel(t, rendered, 100, 900, expected)
+		expectPixel(t, rendered, 119, 909, expected)
+
+		if objects := displaySets[i].Objects(); len(objects) != 1 || objects[0].ObjectId != 0 {
+			t.Fatalf("display set %d: expected object 0 to be defined, got %d objects", i, len(objects))
+		}
+	}
+
+	newEpoch := displaySets[3]
+
+	if len(newEpoch.Objects()) != 0 || len(newEpoch.Palettes()) != 0 || len(newEpoch.Windows()) != 0 {
+		t.Fatalf("expected the epoch start to drop previous definitions, got %d objects, %d palettes and %d windows",
+			len(newEpoch.Objects()), len(newEpoch.Palettes()), len(newEpoch.Windows()))
+	}
+
+	if _, err := newEpoch.ToImageData(); !errors.Is(err, ErrUndefinedPalette) {
+		t.Fatalf("expected %v, got %v", ErrUndefinedPalette, err)
+	}
+}
+
+func TestRenderPaletteUpdate(t *testing.T) {
+	// Light left half and dark right half
+	object := newBitmap(20, 10, func(x int, y int) byte {
+		if x < 10 {
+			return 1
+		}
+
+		return 2
+	})
+	var data []byte
+
+	data = append(data, testSegment(1, 0x16, testPcsPayload(0x80, testCompositionObject(0, 0, 0x00, 100, 900)))...)
+	data = append(data, testSegment(1, 0x17, testWdsPayload([5]int{0, 100, 900, 20, 10}))...)
+	data = append(data, testSegment(1, 0x14, testPdsPayload(0))...)
+	data = append(data, testSegment(1, 0x15, testOdsPayloads(0, object, 1)[0])...)
+	data = append(data, testSegment(1, 0x80, nil)...)
+
+	// Palette update without composition objects, swapping the two entries
+	paletteUpdate := testPcsPayload(0x00)
+	paletteUpdate[8] = 0x80
+	data = append(data, testSegment(2, 0x16, paletteUpdate)...)
+	data = append(data, testSegment(2, 0x14, testPdsPayload(1, [5]byte{1, 16, 128, 128, 255}, [5]byte{2, 235, 128, 128, 255}))...)
+	data = append(data, testSegment(2, 0x80, nil)...)
+
+	displaySets := parseDisplaySets(t, data)
+
+	if len(displaySets) != 2 {
+		t.Fatalf("expected 2 display sets, got %d", len(displaySets))
+	}
+
+	update := displaySets[1]
+
+	if !update.IsPaletteUpdate() {
+		t.Fatal("expected a palette update")
+	}
+
+	if objects := update.CompositionObjects(); len(objects) != 1 || objects[0] != displaySets[0].CompositionObjects()[0] {
+		t.Fatalf("expected the palette update to apply to the object on screen, got %+v", objects)
+	}
+
+	before := renderPixels(t, displaySets[0], RenderOptions{})
+	after := renderPixels(t, update, RenderOptions{})
+
+	if !after.PaletteUpdate || before.PaletteUpdate {
+		t.Fatalf("expected only the second image to be a palette update, got %t and %t", before.PaletteUpdate, after.PaletteUpdate)
+	}
+
+	if after.X != before.X || after.Y != before.Y || after.Width != before.Width || after.Height != before.Height {
+		t.Fatalf("expected the palette update to keep the bounds %dx%d at %d,%d, got %dx%d at %d,%d",
+			before.Width, before.Height, before.X, before.Y, after.Width, after.Height, after.X, after.Y)
+	}
+
+	expectPixel(t, before, 100, 900, testLight)
+	expectPixel(t, before, 119, 909, testDark)
+	expectPixel(t, after, 100, 900, testDark)
+	expectPixel(t, after, 119, 909, testLight)
+}
+
+func TestRenderPalettedImage(t *testing.T) {
+	// Light left half and dark right half
+	object := newBitmap(20, 10, func(x int, y int) byte {
+		if x < 10 {
+			return 1
+		}
+
+		return 2
+	})
+	var data []byte
+
+	data = append(data, testSegment(1, 0x16, testPcsPayload(0x80, testCompositionObject(0, 0, 0x00, 100, 900)))...)
+	data = append(data, testSegment(1, 0x17, testWdsPayload([5]int{0, 100, 900, 20, 10}))...)
+	data = append(data, testSegment(1, 0x14, testPdsPayload(0))...)
+	data = append(data, testSegment(1, 0x15, testOdsPayloads(0, object, 1)[0])...)
+	data = append(data, testSegment(1, 0x80, nil)...)
+
+	set := parseDisplaySets(t, data)[0]
+
+	testCases := []struct {
+		name    string
+		options RenderOptions
+		light   color.Color
+		dark    color.Color
+	}{
+		{"default conversion", RenderOptions{Paletted: true, FullCanvas: true}, testLight, testDark},
+		{
+			"color conversion",
+			RenderOptions{Paletted: true, FullCanvas: true, ColorConversion: &ColorConversion{Matrix: ColorMatrixBt709, Range: ColorRangeLimited}},
+			color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+			color.NRGBA{A: 255},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rendered := renderPixels(t, set, testCase.options)
+			img, ok := rendered.Image.(*image.Paletted)
+
+			if !ok {
+				t.Fatalf("expected an *image.Paletted, got %T", rendered.Image)
+			}
+
+			for _, pixel := range []struct {
+				x     int
+				y     int
+				index uint8
+			}{
+				{100, 900, 1},
+				{109, 909, 1},
+				{110, 900, 2},
+				{119, 909, 2},
+				// Outside of the object, filled with an undefined and thus transparent entry
+				{0, 0, 0},
+				{120, 900, 0},
+			} {
+				if got := img.ColorIndexAt(pixel.x, pixel.y); got != pixel.index {
+					t.Errorf("expected palette entry %d at %d,%d, got %d", pixel.index, pixel.x, pixel.y, got)
+				}
+			}
+
+			if !sameColor(img.Palette[1], testCase.light) || !sameColor(img.Palette[2], testCase.dark) || !sameColor(img.Palette[0], testTransparent) {
+				t.Fatalf("expected entries 0, 1 and 2 to be transparent, %v and %v, got %v, %v and %v",
+					testCase.light, testCase.dark, img.Palette[0], img.Palette[1], img.Palette[2])
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package displaySet
+
+import (
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/segment"
+)
+
+// Object Bitmap of an object, assembled from its ODS fragments
+type Object struct {
+	ObjectId            int
+	ObjectVersionNumber int
+	Width               int
+	Height              int
+	ObjectData          []buffer.BufferAdapter
+}
+
+// epoch Decoder state shared by the display sets of an epoch: objects, palettes and windows are kept until they're
+// redefined or until the next epoch start, so that a display set can show what was defined by a previous one
+type epoch struct {
+	objects  map[int]*Object
+	palettes map[int]*segment.PaletteDefinitionSegment
+	windows  map[int]segment.WindowDefinition
+
+	// compositionObjects Objects on screen, as composed by the last PCS which isn't a palette update
+	compositionObjects []segment.CompositionObject
+}
+
+func newEpoch() *epoch {
+	return &epoch{
+		objects:  map[int]*Object{},
+		palettes: map[int]*segment.PaletteDefinitionSegment{},
+		windows:  map[int]segment.WindowDefinition{},
+	}
+}
+
+func (e *epoch) setComposition(pcs segment.PresentationCompositionSegment) {
+	if !pcs.PaletteUpdateFlag {
+		e.compositionObjects = pcs.CompositionObjects
+	}
+}
+
+func (e *epoch) addWindows(wds segment.WindowDefinitionSegment) {
+	for _, window := range wds.WindowDefinitions {
+		e.windows[window.WindowId] = window
+	}
+}
+
+func (e *epoch) addPalette(pds segment.PaletteDefinitionSegment) {
+	e.palettes[pds.PaletteId] = &pds
+}
+
+// addObjectFragment Start a new object version on a first in sequence ODS, or append data to the object being defined
+func (e *epoch) addObjectFragment(ods segment.ObjectDefinitionSegment) bool {
+	if ods.Width != nil && ods.Height != nil {
+		e.objects[ods.ObjectId] = &Object{
+			ObjectId:            ods.ObjectId,
+			ObjectVersionNumber: ods.ObjectVersionNumber,
+			Width:               *ods.Width,
+			Height:              *ods.Height,
+			ObjectData:          []buffer.BufferAdapter{ods.ObjectData},
+		}
+		return true
+	}
+
+	current, ok := e.objects[ods.ObjectId]
+
+	if !ok || current.ObjectVersionNumber != ods.ObjectVersionNumber {
+		return false
+	}
+
+	// Copied as the object may be shared with snapshots
+	updated := *current
+	updated.ObjectData = append(current.ObjectData[:len(current.ObjectData):len(current.ObjectData)], ods.ObjectData)
+	e.objects[ods.ObjectId] = &updated
+	return true
+}
+
+// snapshot Copy the current state, so that later definitions don't change what a parsed display set shows
+func (e *epoch) snapshot() *epoch {
+	s := newEpoch()
+
+	for id, o := range e.objects {
+		s.objects[id] = o
+	}
+
+	for id, p := range e.palettes {
+		s.palettes[id] = p
+	}
+
+	for id, w := range e.windows {
+		s.windows[id] = w
+	}
+
+	s.compositionObjects = e.compositionObjects
+
+	return s
+}
+
+// Data RLE encoded bitmap of the object, its fragments being concatenated into a new slice
+func (o Object) Data() []byte {
+	var data []byte
+
+	for _, fragment := range o.ObjectData {
+		data = append(data, buffer.Bytes(fragment)...)
+	}
+
+	return data
+}
@@ -0,0 +1,59 @@
+package displaySet
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/segment"
+)
+
+var (
+	// ErrInvalidMagicNumber A segment header doesn't start with "PG"
+	ErrInvalidMagicNumber = errors.New("invalid magic number")
+
+	// ErrUnexpectedSegment A segment isn't allowed at its position in the display set
+	ErrUnexpectedSegment = errors.New("unexpected segment")
+
+	// ErrUnexpectedObjectFragment An ODS continues an object whose first fragment wasn't found
+	ErrUnexpectedObjectFragment = errors.New("unexpected ODS fragment")
+
+	// ErrUndefinedPalette A PCS references a palette not defined in the current epoch
+	ErrUndefinedPalette = errors.New("undefined palette")
+
+	// ErrUndefinedObject A PCS references an object not defined in the current epoch
+	ErrUndefinedObject = errors.New("undefined object")
+
+	// ErrTruncatedObjectData The RLE data of an object ends in the middle of a run
+	ErrTruncatedObjectData = errors.New("truncated object data")
+)
+
+// ParseError Error raised while parsing a segment, with the position of the segment in the stream
+type ParseError struct {
+	// Offset Byte offset of the segment header in the stream
+	Offset int64
+
+	// SegmentIndex Index of the segment in the stream
+	SegmentIndex int
+
+	// SegmentType Type of the segment, nil when its header couldn't be parsed
+	SegmentType *segment.SegmentType
+
+	// DisplaySetIndex Index of the display set the segment belongs to
+	DisplaySetIndex int
+
+	// Err Cause of the error
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	name := "segment"
+
+	if e.SegmentType != nil {
+		name = e.SegmentType.String() + " segment"
+	}
+
+	return fmt.Sprintf("%s %d of display set %d at offset %d: %v", name, e.SegmentIndex, e.DisplaySetIndex, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,242 @@
+package displaySet
+
+import (
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// MaxPaletteColors Colors available for an encoded object, palette entry 0 being reserved for transparent pixels
+const MaxPaletteColors = 255
+
+type colorCount struct {
+	color color.NRGBA
+	count int
+}
+
+// Quantize Reduce the image to at most MaxPaletteColors colors, with fully transparent pixels mapped to the entry 0.
+// Images with few enough colors keep their exact colors, others are reduced with a median cut
+func Quantize(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+	counts := map[color.NRGBA]int{}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+
+			if c.A > 0 {
+				counts[c]++
+			}
+		}
+	}
+
+	var colors []colorCount
+
+	for c, count := range counts {
+		colors = append(colors, colorCount{color: c, count: count})
+	}
+
+	// Map iteration order is random, keep the palette deterministic
+	sort.Slice(colors, func(i int, j int) bool {
+		return colorKey(colors[i].color) < colorKey(colors[j].color)
+	})
+
+	palette := color.Palette{color.NRGBA{}}
+
+	if len(colors) < MaxPaletteColors {
+		for _, c := range colors {
+			palette = append(palette, c.color)
+		}
+	} else {
+		palette = append(palette, medianCut(colors, MaxPaletteColors-1)...)
+	}
+
+	paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+	indices := map[color.NRGBA]uint8{}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+
+			if c.A == 0 {
+				continue
+			}
+
+			index, ok := indices[c]
+
+			if !ok {
+				index = nearestColorIndex(palette, c)
+				indices[c] = index
+			}
+
+			paletted.SetColorIndex(x-bounds.Min.X, y-bounds.Min.Y, index)
+		}
+	}
+
+	return paletted
+}
+
+// PaletteEntries Convert a palette to PDS entries, the palette index being the entry id
+func PaletteEntries(palette color.Palette, conversion ColorConversion) []segment.PaletteEntry {
+	var entries []segment.PaletteEntry
+
+	for i, c := range palette {
+		nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+		y, cb, cr := conversion.fromRgb(float64(nrgba.R), float64(nrgba.G), float64(nrgba.B))
+
+		entries = append(entries, segment.PaletteEntry{
+			PaletteEntryId:      i,
+			Luminance:           clampByte(y),
+			ColorDifferenceRed:  clampByte(cr),
+			ColorDifferenceBlue: clampByte(cb),
+			Transparency:        int(nrgba.A),
+		})
+	}
+
+	return entries
+}
+
+// medianCut Split the colors in boxes of similar colors, and return the average color of each box
+func medianCut(colors []colorCount, maxColors int) []color.Color {
+	boxes := [][]colorCount{colors}
+
+	for len(boxes) < maxColors {
+		boxIndex, channel := widestBox(boxes)
+
+		if boxIndex < 0 {
+			break
+		}
+
+		box := boxes[boxIndex]
+
+		sort.Slice(box, func(i int, j int) bool {
+			return channelValue(box[i].color, channel) < channelValue(box[j].color, channel)
+		})
+
+		total := 0
+		for _, c := range box {
+			total += c.count
+		}
+
+		// Split at the median pixel, keeping at least one color on each side
+		median := 1
+		accumulated := box[0].count
+		for median < len(box)-1 && accumulated < total/2 {
+			accumulated += box[median].count
+			median++
+		}
+
+		boxes[boxIndex] = box[:median]
+		boxes = append(boxes, box[median:])
+	}
+
+	var palette []color.Color
+
+	for _, box := range boxes {
+		palette = append(palette, averageColor(box))
+	}
+
+	return palette
+}
+
+// widestBox Find the box with the widest channel range, or -1 if every box holds a single color
+func widestBox(boxes [][]colorCount) (int, int) {
+	boxIndex := -1
+	widestChannel := 0
+	widestRange := -1
+
+	for i, box := range boxes {
+		if len(box) < 2 {
+			continue
+		}
+
+		for channel := 0; channel < 4; channel++ {
+			low := 255
+			high := 0
+
+			for _, c := range box {
+				value := channelValue(c.color, channel)
+				if value < low {
+					low = value
+				}
+				if value > high {
+					high = value
+				}
+			}
+
+			if high-low > widestRange {
+				boxIndex = i
+				widestChannel = channel
+				widestRange = high - low
+			}
+		}
+	}
+
+	return boxIndex, widestChannel
+}
+
+func averageColor(box []colorCount) color.NRGBA {
+	var r, g, b, a, total float64
+
+	for _, c := range box {
+		weight := float64(c.count)
+		r += float64(c.color.R) * weight
+		g += float64(c.color.G) * weight
+		b += float64(c.color.B) * weight
+		a += float64(c.color.A) * weight
+		total += weight
+	}
+
+	return color.NRGBA{
+		R: uint8(math.Round(r / total)),
+		G: uint8(math.Round(g / total)),
+		B: uint8(math.Round(b / total)),
+		A: uint8(math.Round(a / total)),
+	}
+}
+
+// nearestColorIndex Index of the closest non transparent palette entry
+func nearestColorIndex(palette color.Palette, c color.NRGBA) uint8 {
+	nearest := 1
+	nearestDistance := math.MaxInt
+
+	for i := 1; i < len(palette); i++ {
+		p := palette[i].(color.NRGBA)
+		distance := 0
+
+		for channel := 0; channel < 4; channel++ {
+			delta := channelValue(p, channel) - channelValue(c, channel)
+			distance += delta * delta
+		}
+
+		if distance < nearestDistance {
+			nearest = i
+			nearestDistance = distance
+		}
+	}
+
+	return uint8(nearest)
+}
+
+func channelValue(c color.NRGBA, channel int) int {
+	switch channel {
+	case 0:
+		return int(c.R)
+	case 1:
+		return int(c.G)
+	case 2:
+		return int(c.B)
+	}
+
+	return int(c.A)
+}
+
+func colorKey(c color.NRGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+func clampByte(value float64) int {
+	return int(math.Max(0, math.Min(255, math.Round(value))))
+}
@@ -0,0 +1,62 @@
+package displaySet
+
+import "image"
+
+// maxRunLength Longest run which can be encoded by a single code
+const maxRunLength = 16383
+
+// RleEncode Encode an indexed bitmap into PGS object data, the inverse of rleDecode.
+// Each run uses the shortest code available and each line ends with an end of line marker
+func RleEncode(img *image.Paletted) []byte {
+	bounds := img.Bounds()
+	var encoded []byte
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		line := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+
+		for x := 0; x < len(line); {
+			colorIndex := line[x]
+			runLength := 1
+
+			for x+runLength < len(line) && line[x+runLength] == colorIndex && runLength < maxRunLength {
+				runLength++
+			}
+
+			encoded = rleEncodeRun(encoded, colorIndex, runLength)
+			x += runLength
+		}
+
+		// 00000000 00000000 - End of line
+		encoded = append(encoded, 0, 0)
+	}
+
+	return encoded
+}
+
+func rleEncodeRun(encoded []byte, colorIndex byte, runLength int) []byte {
+	if colorIndex == 0 {
+		if runLength < 64 {
+			// 00000000 00LLLLLL - L pixels in color 0 (L between 1 and 63)
+			return append(encoded, 0, byte(runLength))
+		}
+
+		// 00000000 01LLLLLL LLLLLLLL - L pixels in color 0 (L between 64 and 16383)
+		return append(encoded, 0, byte(64|runLength>>8), byte(runLength))
+	}
+
+	if runLength <= 2 {
+		// CCCCCCCC - One pixel in color C, repeated as it's shorter than a run
+		for i := 0; i < runLength; i++ {
+			encoded = append(encoded, colorIndex)
+		}
+		return encoded
+	}
+
+	if runLength < 64 {
+		// 00000000 10LLLLLL CCCCCCCC - L pixels in color C (L between 3 and 63)
+		return append(encoded, 0, byte(128|runLength), colorIndex)
+	}
+
+	// 00000000 11LLLLLL LLLLLLLL CCCCCCCC - L pixels in color C (L between 64 and 16383)
+	return append(encoded, 0, byte(192|runLength>>8), byte(runLength), colorIndex)
+}
@@ -0,0 +1,123 @@
+package displaySet
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// rleRoundTrip Encode then decode the bitmap, failing if the decoded pixels differ
+func rleRoundTrip(t *testing.T, img *image.Paletted) {
+	t.Helper()
+
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	decoded := make([]byte, width*height)
+	outOfBounds := 0
+
+	err := (&displaySet{}).rleDecode(context.Background(), RleEncode(img), func(x int, y int, paletteIndex int) {
+		if x >= width || y >= height {
+			outOfBounds++
+			return
+		}
+
+		decoded[y*width+x] = byte(paletteIndex)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if outOfBounds > 0 {
+		t.Fatalf("%d pixels decoded outside of the %dx%d bitmap", outOfBounds, width, height)
+	}
+
+	if !bytes.Equal(decoded, img.Pix) {
+		t.Fatalf("decoded %dx%d bitmap differs from the encoded one", width, height)
+	}
+}
+
+// newBitmap Paletted image of the given size filled by pixel
+func newBitmap(width int, height int, pixel func(x int, y int) byte) *image.Paletted {
+	palette := make(color.Palette, 256)
+
+	for i := range palette {
+		palette[i] = color.Gray{Y: uint8(i)}
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetColorIndex(x, y, pixel(x, y))
+		}
+	}
+
+	return img
+}
+
+func TestRleEncodeRandomBitmaps(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 50; i++ {
+		colors := 1 + random.Intn(8)
+		runChance := random.Float64()
+		var previous byte
+
+		rleRoundTrip(t, newBitmap(1+random.Intn(300), 1+random.Intn(50), func(x int, y int) byte {
+			// Mix of single pixels and runs of various lengths
+			if x == 0 || random.Float64() > runChance {
+				previous = byte(random.Intn(colors))
+			}
+
+			return previous
+		}))
+	}
+}
+
+func TestRleEncodeRunLengths(t *testing.T) {
+	for _, runLength := range []int{1, 2, 3, 62, 63, 64, 65, 255, 256, 16382, 16383, 16384, 16385, 32766, 32767} {
+		for _, colorIndex := range []byte{0, 1, 255} {
+			// A run surrounded by pixels of another color, and a line made of the run only
+			rleRoundTrip(t, newBitmap(runLength+2, 2, func(x int, y int) byte {
+				if y == 0 && (x == 0 || x == runLength+1) {
+					return colorIndex ^ 0x7F
+				}
+
+				if y == 1 && x >= runLength {
+					return colorIndex ^ 0x7F
+				}
+
+				return colorIndex
+			}))
+		}
+	}
+}
+
+func TestRleEncodeTransparentLines(t *testing.T) {
+	rleRoundTrip(t, newBitmap(500, 20, func(x int, y int) byte {
+		if y%2 == 0 {
+			return 0
+		}
+
+		return byte(x % 3)
+	}))
+}
+
+func TestRleEncodeWideBitmaps(t *testing.T) {
+	for _, width := range []int{16383, 16384, 20000, 40000} {
+		rleRoundTrip(t, newBitmap(width, 3, func(x int, y int) byte {
+			switch y {
+			case 0:
+				return 0
+			case 1:
+				return 7
+			default:
+				return byte(x / 5000)
+			}
+		}))
+	}
+}
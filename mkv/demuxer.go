@@ -0,0 +1,515 @@
+package mkv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// PgsCodecId Codec id of the PGS subtitle tracks
+const PgsCodecId = "S_HDMV/PGS"
+
+const (
+	idEbml                 = 0x1A45DFA3
+	idSegment              = 0x18538067
+	idInfo                 = 0x1549A966
+	idTimestampScale       = 0x2AD7B1
+	idTracks               = 0x1654AE6B
+	idTrackEntry           = 0xAE
+	idTrackNumber          = 0xD7
+	idCodecId              = 0x86
+	idName                 = 0x536E
+	idLanguage             = 0x22B59C
+	idLanguageBcp47        = 0x22B59D
+	idFlagDefault          = 0x88
+	idFlagForced           = 0x55AA
+	idContentEncodings     = 0x6D80
+	idContentEncoding      = 0x6240
+	idContentEncodingOrder = 0x5031
+	idContentEncodingScope = 0x5032
+	idContentEncodingType  = 0x5033
+	idContentCompression   = 0x5034
+	idContentCompAlgo      = 0x4254
+	idContentCompSettings  = 0x4255
+	idCluster              = 0x1F43B675
+	idClusterTimestamp     = 0xE7
+	idBlockGroup           = 0xA0
+	idBlock                = 0xA1
+	idSimpleBlock          = 0xA3
+)
+
+const (
+	compressionZlib            = 0
+	compressionHeaderStripping = 3
+)
+
+// defaultTimestampScale Nanoseconds per timestamp unit when the segment info doesn't define it
+const defaultTimestampScale = 1000000
+
+// Track PGS subtitle track of a Matroska file
+type Track struct {
+	Number   int
+	Language string
+	Name     string
+	Default  bool
+	Forced   bool
+
+	codecId   string
+	encodings []contentEncoding
+}
+
+// Block Frame of a track, with its presentation time
+type Block struct {
+	TrackNumber int
+	Timestamp   time.Duration
+	Data        []byte
+}
+
+type contentEncoding struct {
+	order                int
+	scope                int
+	encodingType         int
+	compressionAlgorithm int
+	compressionSettings  []byte
+}
+
+type Demuxer interface {
+	// Tracks Read the header of the file until the track list and return its PGS tracks
+	Tracks() ([]Track, error)
+
+	// NextBlock Return the next frame of the given track, or io.EOF once the file is exhausted.
+	// Laced blocks are split and compressed frames are decompressed
+	NextBlock(trackNumber int) (*Block, error)
+}
+
+type demuxer struct {
+	reader           *ebmlReader
+	tracks           map[int]Track
+	trackNumbers     []int
+	timestampScale   int64
+	clusterTimestamp int64
+	pendingBlocks    []Block
+}
+
+// NewDemuxer Initialize a new Matroska demuxer reading the file sequentially, without seeking
+func NewDemuxer(reader io.Reader) Demuxer {
+	return &demuxer{
+		reader:         newEbmlReader(reader),
+		timestampScale: defaultTimestampScale,
+	}
+}
+
+func (d *demuxer) Tracks() ([]Track, error) {
+	for d.tracks == nil {
+		err := d.readElement(0)
+
+		if err == io.EOF {
+			return nil, errors.New("no track list found")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tracks []Track
+
+	for _, number := range d.trackNumbers {
+		if d.tracks[number].codecId == PgsCodecId {
+			tracks = append(tracks, d.tracks[number])
+		}
+	}
+
+	return tracks, nil
+}
+
+func (d *demuxer) NextBlock(trackNumber int) (*Block, error) {
+	for len(d.pendingBlocks) == 0 {
+		err := d.readElement(trackNumber)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block := d.pendingBlocks[0]
+	d.pendingBlocks = d.pendingBlocks[1:]
+
+	return &block, nil
+}
+
+// readElement Read the next element, queueing the frames of the given track it contains
+func (d *demuxer) readElement(trackNumber int) error {
+	element, err := d.reader.readElement()
+
+	if err != nil {
+		return err
+	}
+
+	switch element.id {
+	case idSegment, idInfo, idCluster, idBlockGroup:
+		// Master elements are entered, their children being read as the next elements
+		return nil
+	case idTimestampScale:
+		d.timestampScale, err = d.readUnsignedInteger(*element)
+
+		return err
+	case idClusterTimestamp:
+		d.clusterTimestamp, err = d.readUnsignedInteger(*element)
+
+		return err
+	case idTracks:
+		data, err := d.reader.readData(*element)
+
+		if err != nil {
+			return err
+		}
+
+		return d.parseTracks(data)
+	case idBlock, idSimpleBlock:
+		data, err := d.reader.readData(*element)
+
+		if err != nil {
+			return err
+		}
+
+		return d.parseBlock(data, trackNumber)
+	}
+
+	return d.reader.skip(*element)
+}
+
+func (d *demuxer) readUnsignedInteger(element ebmlElement) (int64, error) {
+	data, err := d.reader.readData(element)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return readUnsignedInteger(data)
+}
+
+func (d *demuxer) parseTracks(data []byte) error {
+	d.tracks = map[int]Track{}
+	d.trackNumbers = nil
+
+	return forEachChild(data, func(id int, data []byte) error {
+		if id != idTrackEntry {
+			return nil
+		}
+
+		track, err := parseTrackEntry(data)
+
+		if err != nil {
+			return err
+		}
+
+		d.tracks[track.Number] = *track
+		d.trackNumbers = append(d.trackNumbers, track.Number)
+
+		return nil
+	})
+}
+
+func (d *demuxer) parseBlock(data []byte, trackNumber int) error {
+	number, length, err := readVintFromBytes(data)
+
+	if err != nil {
+		return err
+	}
+
+	track, ok := d.tracks[int(number)]
+
+	if !ok || track.Number != trackNumber {
+		return nil
+	}
+
+	if len(data) < length+3 {
+		return fmt.Errorf("block of track %d is too short", number)
+	}
+
+	relativeTimestamp := int16(uint16(data[length])<<8 | uint16(data[length+1]))
+	flags := data[length+2]
+
+	frames, err := splitLacing(data[length+3:], (flags>>1)&0x03)
+
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Duration((d.clusterTimestamp + int64(relativeTimestamp)) * d.timestampScale)
+
+	for _, frame := range frames {
+		frame, err = track.decode(frame)
+
+		if err != nil {
+			return err
+		}
+
+		d.pendingBlocks = append(d.pendingBlocks, Block{
+			TrackNumber: trackNumber,
+			Timestamp:   timestamp,
+			Data:        frame,
+		})
+	}
+
+	return nil
+}
+
+func parseTrackEntry(data []byte) (*Track, error) {
+	track := &Track{
+		Language: "eng",
+		Default:  true,
+	}
+
+	var languageBcp47 string
+
+	err := forEachChild(data, func(id int, data []byte) error {
+		var err error
+		var value int64
+
+		switch id {
+		case idTrackNumber:
+			value, err = readUnsignedInteger(data)
+			track.Number = int(value)
+		case idCodecId:
+			track.codecId = readString(data)
+		case idName:
+			track.Name = readString(data)
+		case idLanguage:
+			track.Language = readString(data)
+		case idLanguageBcp47:
+			languageBcp47 = readString(data)
+		case idFlagDefault:
+			value, err = readUnsignedInteger(data)
+			track.Default = value != 0
+		case idFlagForced:
+			value, err = readUnsignedInteger(data)
+			track.Forced = value != 0
+		case idContentEncodings:
+			track.encodings, err = parseContentEncodings(data)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// LanguageBCP47 takes precedence over Language when both are present
+	if languageBcp47 != "" {
+		track.Language = languageBcp47
+	}
+
+	return track, nil
+}
+
+// parseContentEncodings Parse the encodings of a track, sorted in the order they must be undone
+func parseContentEncodings(data []byte) ([]contentEncoding, error) {
+	var encodings []contentEncoding
+
+	err := forEachChild(data, func(id int, data []byte) error {
+		if id != idContentEncoding {
+			return nil
+		}
+
+		encoding := contentEncoding{
+			scope: 1,
+		}
+
+		err := forEachChild(data, func(id int, data []byte) error {
+			var err error
+			var value int64
+
+			switch id {
+			case idContentEncodingOrder:
+				value, err = readUnsignedInteger(data)
+				encoding.order = int(value)
+			case idContentEncodingScope:
+				value, err = readUnsignedInteger(data)
+				encoding.scope = int(value)
+			case idContentEncodingType:
+				value, err = readUnsignedInteger(data)
+				encoding.encodingType = int(value)
+			case idContentCompression:
+				err = forEachChild(data, func(id int, data []byte) error {
+					var err error
+
+					switch id {
+					case idContentCompAlgo:
+						value, err = readUnsignedInteger(data)
+						encoding.compressionAlgorithm = int(value)
+					case idContentCompSettings:
+						encoding.compressionSettings = data
+					}
+
+					return err
+				})
+			}
+
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		encodings = append(encodings, encoding)
+
+		return nil
+	})
+
+	// The encoding with the highest order was applied last, so it's undone first
+	sort.SliceStable(encodings, func(i, j int) bool {
+		return encodings[i].order > encodings[j].order
+	})
+
+	return encodings, err
+}
+
+// decode Undo the content encodings applied to the frames of the track
+func (t Track) decode(frame []byte) ([]byte, error) {
+	for _, encoding := range t.encodings {
+		if encoding.scope&0x01 == 0 {
+			// Only applies to the codec private data
+			continue
+		}
+
+		if encoding.encodingType != 0 {
+			return nil, fmt.Errorf("track %d is encrypted", t.Number)
+		}
+
+		switch encoding.compressionAlgorithm {
+		case compressionZlib:
+			reader, err := zlib.NewReader(bytes.NewReader(frame))
+
+			if err != nil {
+				return nil, err
+			}
+
+			frame, err = io.ReadAll(reader)
+
+			if err != nil {
+				return nil, err
+			}
+		case compressionHeaderStripping:
+			frame = append(append([]byte(nil), encoding.compressionSettings...), frame...)
+		default:
+			return nil, fmt.Errorf("unsupported compression algorithm %d on track %d", encoding.compressionAlgorithm, t.Number)
+		}
+	}
+
+	return frame, nil
+}
+
+// splitLacing Split the frames of a block according to its lacing: 0 none, 1 Xiph, 2 fixed-size, 3 EBML
+func splitLacing(data []byte, lacing byte) ([][]byte, error) {
+	if lacing == 0 {
+		return [][]byte{data}, nil
+	}
+
+	if len(data) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	count := int(data[0]) + 1
+	data = data[1:]
+	sizes := make([]int, count-1)
+
+	switch lacing {
+	case 1:
+		for i := range sizes {
+			for {
+				if len(data) == 0 {
+					return nil, io.ErrUnexpectedEOF
+				}
+
+				// Sizes are sums of bytes, a byte below 255 ending the size
+				b := data[0]
+				sizes[i] += int(b)
+				data = data[1:]
+
+				if b != 255 {
+					break
+				}
+			}
+		}
+	case 2:
+		if len(data)%count != 0 {
+			return nil, fmt.Errorf("fixed-size lacing of %d bytes into %d frames", len(data), count)
+		}
+
+		for i := range sizes {
+			sizes[i] = len(data) / count
+		}
+	case 3:
+		for i := range sizes {
+			value, length, err := readVintFromBytes(data)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if i == 0 {
+				sizes[i] = int(value)
+			} else {
+				// Following sizes are signed differences with the previous one
+				sizes[i] = sizes[i-1] + int(value-(1<<(7*length-1)-1))
+			}
+
+			data = data[length:]
+		}
+	}
+
+	var frames [][]byte
+
+	for _, size := range sizes {
+		if size < 0 || size > len(data) {
+			return nil, fmt.Errorf("invalid laced frame size %d", size)
+		}
+
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+
+	return append(frames, data), nil
+}
+
+// forEachChild Call onChild with the id and data of each child of a master element
+func forEachChild(data []byte, onChild func(id int, data []byte) error) error {
+	reader := newEbmlReader(bytes.NewReader(data))
+
+	for {
+		element, err := reader.readElement()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		child, err := reader.readData(*element)
+
+		if err != nil {
+			return err
+		}
+
+		err = onChild(element.id, child)
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readString Decode the data of a string element, which may be padded with zeros
+func readString(data []byte) string {
+	return string(bytes.TrimRight(data, "\x00"))
+}
@@ -0,0 +1,54 @@
+package mkv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// corruptedTracks EBML header followed by a segment whose track list claims a size of 0x7FFFFFFFFFFFF0 bytes
+func corruptedTracks(size []byte) []byte {
+	var data []byte
+
+	// EBML header, empty
+	data = append(data, 0x1A, 0x45, 0xDF, 0xA3, 0x80)
+	// Segment, unknown size
+	data = append(data, 0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	// Tracks
+	data = append(data, 0x16, 0x54, 0xAE, 0x6B)
+	data = append(data, size...)
+
+	return append(data, 0xAE, 0x83, 0xD7, 0x81, 0x01)
+}
+
+func TestTracksWithCorruptedElementSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size []byte
+	}{
+		{"huge", []byte{0x01, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF0}},
+		{"unknown", []byte{0xFF}},
+		{"past end of file", []byte{0x40, 0x40}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracks, err := NewDemuxer(bytes.NewReader(corruptedTracks(test.size))).Tracks()
+
+			if err == nil {
+				t.Fatalf("expected an error, got tracks %v", tracks)
+			}
+		})
+	}
+}
+
+func TestReadDataPastEndOfFile(t *testing.T) {
+	reader := newEbmlReader(bytes.NewReader([]byte{1, 2, 3}))
+
+	_, err := reader.readData(ebmlElement{id: idTracks, size: 10})
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package mkv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// unknownSize Size of a master element whose end is only known by parsing its children (live streams)
+const unknownSize = -1
+
+// maxElementDataSize Largest element data read in memory, way above the size of a subtitle block or of the track headers
+const maxElementDataSize = 64 * 1024 * 1024
+
+type ebmlElement struct {
+	id   int
+	size int64
+}
+
+// ebmlReader Reads EBML elements one after the other, master elements being entered by simply reading their children
+type ebmlReader struct {
+	reader io.Reader
+}
+
+func newEbmlReader(reader io.Reader) *ebmlReader {
+	return &ebmlReader{
+		reader: reader,
+	}
+}
+
+// readElement Read the id and size of the next element
+func (e *ebmlReader) readElement() (*ebmlElement, error) {
+	id, _, err := e.readVint(4, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	size, length, err := e.readVint(8, false)
+
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// All data bits set means unknown size
+	if size == 1<<(7*length)-1 {
+		size = unknownSize
+	}
+
+	return &ebmlElement{
+		id:   int(id),
+		size: size,
+	}, nil
+}
+
+// readData Read the whole data of an element
+func (e *ebmlReader) readData(element ebmlElement) ([]byte, error) {
+	if element.size == unknownSize {
+		return nil, fmt.Errorf("element %x has an unknown size", element.id)
+	}
+
+	if element.size > maxElementDataSize {
+		return nil, fmt.Errorf("element %x is too large: %d bytes", element.id, element.size)
+	}
+
+	// Only allocate what's actually read, the size may be corrupted
+	data, err := io.ReadAll(io.LimitReader(e.reader, element.size))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) < element.size {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return data, nil
+}
+
+// skip Discard the data of an element
+func (e *ebmlReader) skip(element ebmlElement) error {
+	if element.size == unknownSize {
+		return fmt.Errorf("element %x has an unknown size", element.id)
+	}
+
+	skipped, err := io.CopyN(io.Discard, e.reader, element.size)
+
+	if err == io.EOF || (err == nil && skipped < element.size) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// readVint Read a variable size integer, keeping its length marker for ids
+func (e *ebmlReader) readVint(maxLength int, keepMarker bool) (int64, int, error) {
+	first := make([]byte, 1)
+
+	_, err := io.ReadFull(e.reader, first)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length := 1
+
+	for length <= maxLength && first[0]&(0x80>>(length-1)) == 0 {
+		length++
+	}
+
+	if length > maxLength {
+		return 0, 0, fmt.Errorf("invalid variable size integer starting with %x", first[0])
+	}
+
+	rest := make([]byte, length-1)
+
+	_, err = io.ReadFull(e.reader, rest)
+
+	if err == io.EOF {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	value := int64(first[0])
+
+	if !keepMarker {
+		value &= int64(0xFF >> length)
+	}
+
+	for _, b := range rest {
+		value = value<<8 | int64(b)
+	}
+
+	return value, length, nil
+}
+
+// readUnsignedInteger Decode the data of an unsigned integer element
+func readUnsignedInteger(data []byte) (int64, error) {
+	if len(data) > 8 {
+		return 0, errors.New("unsigned integer element longer than 8 bytes")
+	}
+
+	value := int64(0)
+
+	for _, b := range data {
+		value = value<<8 | int64(b)
+	}
+
+	return value, nil
+}
+
+// readVintFromBytes Decode a variable size integer without its length marker from a byte slice
+func readVintFromBytes(data []byte) (int64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+
+	length := 1
+
+	for length <= 8 && data[0]&(0x80>>(length-1)) == 0 {
+		length++
+	}
+
+	if length > 8 || len(data) < length {
+		return 0, 0, fmt.Errorf("invalid variable size integer starting with %x", data[0])
+	}
+
+	value := int64(data[0]) & int64(0xFF>>length)
+
+	for _, b := range data[1:length] {
+		value = value<<8 | int64(b)
+	}
+
+	return value, length, nil
+}
@@ -0,0 +1,83 @@
+package mkv
+
+import (
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"io"
+)
+
+// maxTimestamp SUP timestamps are 32 bits long
+const maxTimestamp = 1<<32 - 1
+
+type supReader struct {
+	demuxer     Demuxer
+	trackNumber int
+	pending     []byte
+}
+
+// NewSupReader Read a PGS track as a SUP stream. Matroska stores the segments of a block without their PG magic number
+// and timestamps, so each segment is prefixed with a header whose PTS is the block timestamp and whose DTS is 0
+func NewSupReader(demuxer Demuxer, trackNumber int) io.Reader {
+	return &supReader{
+		demuxer:     demuxer,
+		trackNumber: trackNumber,
+	}
+}
+
+func (s *supReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		block, err := s.demuxer.NextBlock(s.trackNumber)
+
+		if err != nil {
+			return 0, err
+		}
+
+		s.pending, err = s.toSup(*block)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+
+	return n, nil
+}
+
+// toSup Prefix each segment of the block with a SUP segment header
+func (s *supReader) toSup(block Block) ([]byte, error) {
+	presentationTimestamp := int(block.Timestamp.Nanoseconds() * 9 / 100000)
+
+	if presentationTimestamp < 0 {
+		presentationTimestamp = 0
+	}
+
+	presentationTimestamp &= maxTimestamp
+
+	writer := buffer.NewBufferWriter()
+	data := block.Data
+
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("truncated segment in block at %s", block.Timestamp)
+		}
+
+		size := 3 + (int(data[1])<<8 | int(data[2]))
+
+		if len(data) < size {
+			return nil, fmt.Errorf("truncated segment in block at %s", block.Timestamp)
+		}
+
+		writer.WriteBytes(segment.PgMagicNumber, 2)
+		writer.WriteBytes(presentationTimestamp, 4)
+		writer.WriteBytes(0, 4)
+
+		writer.WriteByteSlice(data[:size])
+
+		data = data[size:]
+	}
+
+	return writer.Bytes(), nil
+}
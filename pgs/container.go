@@ -0,0 +1,85 @@
+package pgs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/mkv"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"github.com/mbiamont/go-pgs-parser/ts"
+	"io"
+)
+
+// ebmlMagicNumber First bytes of a Matroska file
+var ebmlMagicNumber = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// openContainer Detect the container read from reader and return the SUP stream of the selected PGS track.
+// SUP streams are returned as is
+func (p *pgsParser) openContainer(reader io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	header, err := buffered.Peek(ts.DetectionHeaderLength)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(header, ebmlMagicNumber) {
+		return p.openMkvTrack(buffered)
+	}
+
+	if len(header) >= 2 && int(header[0])<<8|int(header[1]) == segment.PgMagicNumber {
+		// Checked before the sync bytes of transport streams, which SUP bytes can match by chance
+		return buffered, nil
+	}
+
+	if ts.DetectPacketSize(header) != 0 {
+		return p.openTsStream(buffered)
+	}
+
+	return buffered, nil
+}
+
+func (p *pgsParser) openMkvTrack(reader io.Reader) (io.Reader, error) {
+	demuxer := mkv.NewDemuxer(reader)
+
+	tracks, err := demuxer.Tracks()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, track := range tracks {
+		if p.mkvTrack == 0 || track.Number == p.mkvTrack {
+			return mkv.NewSupReader(demuxer, track.Number), nil
+		}
+	}
+
+	if p.mkvTrack == 0 {
+		return nil, fmt.Errorf("no %s track found", mkv.PgsCodecId)
+	}
+
+	return nil, fmt.Errorf("track %d is not a %s track", p.mkvTrack, mkv.PgsCodecId)
+}
+
+func (p *pgsParser) openTsStream(reader io.Reader) (io.Reader, error) {
+	demuxer := ts.NewDemuxer(reader)
+
+	streams, err := demuxer.Streams()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		if p.tsPid == 0 || stream.Pid == p.tsPid {
+			return ts.NewSupReader(demuxer, stream.Pid), nil
+		}
+	}
+
+	if p.tsPid == 0 {
+		return nil, errors.New("no PGS stream found")
+	}
+
+	return nil, fmt.Errorf("PID %x is not a PGS stream", p.tsPid)
+}
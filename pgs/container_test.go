@@ -0,0 +1,70 @@
+package pgs
+
+import (
+	"bytes"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/ts"
+	"testing"
+	"time"
+)
+
+func TestParseMkvWithCorruptedElementSize(t *testing.T) {
+	data := []byte{
+		// EBML header, empty
+		0x1A, 0x45, 0xDF, 0xA3, 0x80,
+		// Segment, unknown size
+		0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		// Tracks of 0x7FFFFFFFFFFFF0 bytes
+		0x16, 0x54, 0xAE, 0x6B, 0x01, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF0,
+	}
+
+	err := NewPgsParser().ParseDisplaySetsFromReader(bytes.NewReader(data), func(data displaySet.DisplaySet, startTime time.Duration) error {
+		return nil
+	})
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestParseSupLookingLikeTransportStream(t *testing.T) {
+	var data []byte
+
+	// The PTS of the segments at 57s has a 0x47 byte at offset 4
+	data = append(data, testSegment(57, testPcs, testPcsPayload(0, 0x80, true))...)
+	data = append(data, testSegment(57, testWds, []byte{1, 0, 0x03, 0x00, 0x03, 0x84, 0, 20, 0, 10})...)
+	palette := []byte{0, 0}
+
+	for id := 0; id < 64; id++ {
+		palette = append(palette, byte(id), 235, 128, 128, 255)
+	}
+
+	data = append(data, testSegment(57, testPds, palette)...)
+	data = append(data, testSegment(57, testOds, testOdsPayload(0, 1))...)
+	data = append(data, testSegment(57, testEnd, nil)...)
+	data = append(data, testNormal(58, 1, false)...)
+
+	// Palette entries at the offsets of the sync bytes of the next M2TS packets
+	data[4+192] = 0x47
+	data[4+2*192] = 0x47
+
+	if ts.DetectPacketSize(data[:ts.DetectionHeaderLength]) == 0 {
+		t.Fatal("expected the SUP stream to have the sync bytes of an M2TS stream")
+	}
+
+	var images []displaySet.ImageData
+
+	err := NewPgsParser().ParsePgsFromReader(bytes.NewReader(data), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		images = append(images, data)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 1 || images[0].StartTime != 57*time.Second || images[0].EndTime != 58*time.Second {
+		t.Fatalf("expected a single image from 57s to 58s, got %d images", len(images))
+	}
+}
@@ -0,0 +1,20 @@
+package pgs
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader Fails reads once the context is done, so that demuxers scanning large containers stop as well
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.reader.Read(p)
+}
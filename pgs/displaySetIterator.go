@@ -0,0 +1,65 @@
+package pgs
+
+import (
+	"context"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"io"
+)
+
+type DisplaySetIterator interface {
+	// Next Return the next display set, pulling bytes from the reader as needed, or io.EOF once the stream is exhausted.
+	// Once an error is returned, every following call returns it again
+	Next() (displaySet.DisplaySet, error)
+}
+
+type displaySetIterator struct {
+	ctx      context.Context
+	parser   *pgsParser
+	reader   io.Reader
+	dsReader *displaySetReader
+	err      error
+}
+
+func newDisplaySetIterator(ctx context.Context, parser *pgsParser, reader io.Reader) DisplaySetIterator {
+	return &displaySetIterator{
+		ctx:    ctx,
+		parser: parser,
+		reader: reader,
+	}
+}
+
+func (i *displaySetIterator) Next() (displaySet.DisplaySet, error) {
+	if i.err != nil {
+		return nil, i.err
+	}
+
+	if i.dsReader == nil {
+		// The container is detected on the first call, so that creating an iterator doesn't read anything
+		source, err := i.parser.openContainer(&contextReader{
+			ctx:    i.ctx,
+			reader: i.reader,
+		})
+
+		if err != nil {
+			i.err = err
+			return nil, err
+		}
+
+		var onWarning func(err error)
+
+		if i.parser.lenient {
+			onWarning = i.parser.onWarning
+		}
+
+		i.dsReader = newDisplaySetReader(source, onWarning)
+	}
+
+	set, err := i.dsReader.next(i.ctx)
+
+	if err != nil {
+		i.err = err
+		return nil, err
+	}
+
+	return set, nil
+}
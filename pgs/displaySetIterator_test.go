@@ -0,0 +1,158 @@
+package pgs
+
+import (
+	"bytes"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"io"
+	"testing"
+	"time"
+)
+
+// testDisplaySetKey What identifies a parsed display set in tests
+type testDisplaySetKey struct {
+	presentationTimestamp int
+	compositionNumber     int
+	objectDefinitions     int
+}
+
+func displaySetKey(set displaySet.DisplaySet) testDisplaySetKey {
+	return testDisplaySetKey{
+		presentationTimestamp: set.PresentationTimestamp(),
+		compositionNumber:     set.CompositionNumber(),
+		objectDefinitions:     len(set.ObjectDefinitionSegments()),
+	}
+}
+
+// testIteratorStream Stream of several epochs, display sets showing and clearing subtitles
+func testIteratorStream() []byte {
+	var data []byte
+
+	data = append(data, testEpochStart(1, 0)...)
+	data = append(data, testNormal(2, 1, false)...)
+	data = append(data, testNormal(3, 2, true)...)
+	data = append(data, testAcquisitionPoint(4, 3, 1, 2)...)
+	data = append(data, testNormal(5, 4, false)...)
+	data = append(data, testEpochStart(6, 5)...)
+
+	return append(data, testNormal(7, 6, false)...)
+}
+
+// parsedDisplaySetKeys Display sets found by ParseDisplaySetsFromReader
+func parsedDisplaySetKeys(t *testing.T, data []byte) []testDisplaySetKey {
+	t.Helper()
+
+	var keys []testDisplaySetKey
+
+	err := NewPgsParser().ParseDisplaySetsFromReader(bytes.NewReader(data), func(data displaySet.DisplaySet, startTime time.Duration) error {
+		keys = append(keys, displaySetKey(data))
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func expectDisplaySetKeys(t *testing.T, expected []testDisplaySetKey, got []testDisplaySetKey) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d display sets, got %d", len(expected), len(got))
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected display set %d to be %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+// countingReader Reader counting the bytes read from it
+type countingReader struct {
+	reader io.Reader
+	read   int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.read += n
+
+	return n, err
+}
+
+func TestIterateDisplaySets(t *testing.T) {
+	data := testIteratorStream()
+	expected := parsedDisplaySetKeys(t, data)
+
+	if len(expected) != 7 {
+		t.Fatalf("expected 7 display sets, got %d", len(expected))
+	}
+
+	iterator := NewPgsParser().IterateDisplaySets(bytes.NewReader(data))
+	var keys []testDisplaySetKey
+
+	for {
+		set, err := iterator.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys = append(keys, displaySetKey(set))
+	}
+
+	expectDisplaySetKeys(t, expected, keys)
+
+	if _, err := iterator.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF again once exhausted, got %v", err)
+	}
+}
+
+func TestIteratorReadsOnDemand(t *testing.T) {
+	reader := &countingReader{reader: newSyntheticStream(t, 100)}
+	iterator := NewPgsParser().IterateDisplaySets(reader)
+
+	if reader.read != 0 {
+		t.Fatalf("expected creating the iterator not to read, got %d bytes read", reader.read)
+	}
+
+	_, err := iterator.Next()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A few chunks at most, the stream being several MB long
+	if reader.read > 4*readChunkSize {
+		t.Fatalf("expected the first display set to be read alone, got %d bytes read", reader.read)
+	}
+}
+
+func TestIteratorRepeatsError(t *testing.T) {
+	data := testEpochStart(1, 0)
+	// Invalid segment type
+	data = append(data, testSegment(2, 0x42, []byte{1, 2, 3})...)
+
+	iterator := NewPgsParser().IterateDisplaySets(bytes.NewReader(data))
+
+	if _, err := iterator.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := iterator.Next()
+
+	if err == nil || err == io.EOF {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+
+	if _, again := iterator.Next(); again != err {
+		t.Fatalf("expected the error to be returned again, got %v", again)
+	}
+}
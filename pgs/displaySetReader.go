@@ -0,0 +1,247 @@
+package pgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"io"
+)
+
+const segmentHeaderLength = 13
+
+// readChunkSize Number of bytes requested from the underlying reader at once
+const readChunkSize = 64 * 1024
+
+// displaySetReader Pulls bytes from a reader in bounded chunks and feeds them to a DisplaySetParser,
+// so that only the bytes of the display set being parsed are held in memory
+type displaySetReader struct {
+	reader            io.Reader
+	parser            displaySet.DisplaySetParser
+	accumulatedBuffer buffer.CompositeBufferReader
+	requestedBytes    int
+	eof               bool
+
+	// onWarning Called with the parse errors skipped in lenient mode, nil when parse errors are returned
+	onWarning func(err error)
+
+	// offset Number of bytes read, segmentOffset being the offset of the segment being read and segmentBytes its bytes
+	offset        int64
+	segmentOffset int64
+	segmentBytes  []buffer.BufferAdapter
+	readingHeader bool
+}
+
+func newDisplaySetReader(reader io.Reader, onWarning func(err error)) *displaySetReader {
+	return &displaySetReader{
+		reader:            reader,
+		parser:            displaySet.NewDisplaySetParser(),
+		accumulatedBuffer: buffer.NewCompositeBufferReader(),
+		requestedBytes:    segmentHeaderLength,
+		eof:               false,
+		onWarning:         onWarning,
+		readingHeader:     true,
+	}
+}
+
+// next Return the next complete DisplaySet, or io.EOF once the reader is exhausted
+func (r *displaySetReader) next(ctx context.Context) (displaySet.DisplaySet, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, r.interrupted(err)
+		}
+
+		err := r.fill()
+
+		if err != nil && ctx.Err() != nil {
+			return nil, r.interrupted(ctx.Err())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if r.accumulatedBuffer.Length() < r.requestedBytes && (r.onWarning == nil || r.accumulatedBuffer.Length() == 0) {
+			// Trailing bytes of an incomplete segment are ignored
+			return nil, io.EOF
+		}
+
+		if r.accumulatedBuffer.Length() < r.requestedBytes {
+			segmentOffset := r.segmentOffset
+
+			if r.readingHeader {
+				segmentOffset = r.offset
+			}
+
+			// e.g. a corrupted segment size
+			r.onWarning(fmt.Errorf("truncated segment at offset %d: %w", segmentOffset, io.ErrUnexpectedEOF))
+
+			if r.readingHeader {
+				// Too short to hold another segment
+				return nil, io.EOF
+			}
+
+			err = r.resync()
+
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if r.readingHeader {
+			r.segmentOffset = r.offset
+			r.segmentBytes = nil
+		}
+
+		bytes, err := r.accumulatedBuffer.ReadBytes(r.requestedBytes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.offset += int64(r.requestedBytes)
+		r.segmentBytes = append(r.segmentBytes, bytes)
+
+		r.requestedBytes, err = r.parser.Consume(bytes)
+
+		var parseError *displaySet.ParseError
+
+		if err != nil && r.onWarning != nil && errors.As(err, &parseError) {
+			r.onWarning(err)
+
+			err = r.resync()
+
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.readingHeader = !r.readingHeader
+
+		if r.parser.IsReady() {
+			ds := r.parser.Next()
+			if ds != nil {
+				return *ds, nil
+			}
+		}
+	}
+}
+
+// interrupted Wrap the error of a done context with the position reached
+func (r *displaySetReader) interrupted(err error) error {
+	return fmt.Errorf("parsing interrupted at offset %d: %w", r.offset, err)
+}
+
+// resync Put back the bytes of the broken segment but its first one, then skip bytes until the next plausible segment header
+func (r *displaySetReader) resync() error {
+	for i := len(r.segmentBytes) - 1; i >= 0; i-- {
+		segmentBytes := r.segmentBytes[i]
+
+		if i == 0 {
+			segmentBytes = segmentBytes.SubArray(1, segmentBytes.Length())
+		}
+
+		r.accumulatedBuffer.Unread(segmentBytes)
+	}
+
+	r.offset = r.segmentOffset + 1
+	r.requestedBytes = segmentHeaderLength
+	r.readingHeader = true
+
+	for {
+		err := r.fill()
+
+		if err != nil {
+			return err
+		}
+
+		if r.accumulatedBuffer.Length() < segmentHeaderLength {
+			break
+		}
+
+		header, err := r.accumulatedBuffer.ReadBytes(segmentHeaderLength)
+
+		if err != nil {
+			return err
+		}
+
+		r.accumulatedBuffer.Unread(header)
+
+		if isSegmentHeader(header) {
+			break
+		}
+
+		_, err = r.accumulatedBuffer.ReadBytes(1)
+
+		if err != nil {
+			return err
+		}
+
+		r.offset++
+	}
+
+	r.parser.Resync(r.offset)
+
+	return nil
+}
+
+// isSegmentHeader Whether the bytes start with the PG magic number and a known segment type
+func isSegmentHeader(header buffer.BufferAdapter) bool {
+	reader := buffer.NewBufferReader(header)
+
+	magicNumber, err := reader.ReadBytes(2)
+
+	if err != nil || magicNumber != segment.PgMagicNumber {
+		return false
+	}
+
+	// Timestamps
+	_, err = reader.ReadBytes(8)
+
+	if err != nil {
+		return false
+	}
+
+	segmentTypeByte, err := reader.ReadBytes(1)
+
+	if err != nil {
+		return false
+	}
+
+	_, err = segment.NewSegmentMapper().ToSegmentType(byte(segmentTypeByte))
+
+	return err == nil
+}
+
+// fill Read chunks until enough bytes are accumulated for the next Consume call or the reader is exhausted
+func (r *displaySetReader) fill() error {
+	for !r.eof && r.accumulatedBuffer.Length() < r.requestedBytes {
+		chunk := make([]byte, readChunkSize)
+		n, err := r.reader.Read(chunk)
+
+		if n > 0 && n < readChunkSize/2 {
+			// Don't keep a whole chunk alive for a short read (e.g. from a pipe)
+			r.accumulatedBuffer.Add(append([]byte(nil), chunk[:n]...))
+		} else if n > 0 {
+			r.accumulatedBuffer.Add(chunk[:n])
+		}
+
+		if err == io.EOF {
+			r.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package pgs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+	"time"
+)
+
+const (
+	testPds = 0x14
+	testOds = 0x15
+	testPcs = 0x16
+	testWds = 0x17
+	testEnd = 0x80
+)
+
+// testSegment SUP segment presented at the given second
+func testSegment(second int, segmentType byte, payload []byte) []byte {
+	timestamp := second * 90000
+	data := []byte{'P', 'G', byte(timestamp >> 24), byte(timestamp >> 16), byte(timestamp >> 8), byte(timestamp), 0, 0, 0, 0, segmentType, byte(len(payload) >> 8), byte(len(payload))}
+
+	return append(data, payload...)
+}
+
+// testPcsPayload PCS of a 1920x1080 video showing object 0 if shown
+func testPcsPayload(compositionNumber int, compositionState byte, shown bool) []byte {
+	pcs := []byte{0x07, 0x80, 0x04, 0x38, 0x10, byte(compositionNumber >> 8), byte(compositionNumber), compositionState, 0, 0, 0}
+
+	if shown {
+		pcs[10] = 1
+		pcs = append(pcs, 0, 0, 0, 0, 0x03, 0x00, 0x03, 0x84)
+	}
+
+	return pcs
+}
+
+// testOdsPayload Object 0 of 20x10 pixels filled with the given palette entry
+func testOdsPayload(version byte, paletteEntry byte) []byte {
+	img := image.NewPaletted(image.Rect(0, 0, 20, 10), make(color.Palette, 256))
+
+	for i := range img.Pix {
+		img.Pix[i] = paletteEntry
+	}
+
+	rle := displaySet.RleEncode(img)
+	ods := []byte{0, 0, version, 0xC0, byte((len(rle) + 4) >> 16), byte((len(rle) + 4) >> 8), byte(len(rle) + 4), 0, 20, 0, 10}
+
+	return append(ods, rle...)
+}
+
+// testEpochStart Display set starting an epoch with object 0 filled with palette entry 1, which is light
+func testEpochStart(second int, compositionNumber int) []byte {
+	var data []byte
+
+	data = append(data, testSegment(second, testPcs, testPcsPayload(compositionNumber, 0x80, true))...)
+	data = append(data, testSegment(second, testWds, []byte{1, 0, 0x03, 0x00, 0x03, 0x84, 0, 20, 0, 10})...)
+	data = append(data, testSegment(second, testPds, []byte{0, 0, 1, 235, 128, 128, 255, 2, 16, 128, 128, 255})...)
+	data = append(data, testSegment(second, testOds, testOdsPayload(0, 1))...)
+
+	return append(data, testSegment(second, testEnd, nil)...)
+}
+
+// testNormal Display set showing or clearing object 0 as defined by previous display sets
+func testNormal(second int, compositionNumber int, shown bool) []byte {
+	data := testSegment(second, testPcs, testPcsPayload(compositionNumber, 0, shown))
+
+	return append(data, testSegment(second, testEnd, nil)...)
+}
+
+func parseLeniently(t *testing.T, data []byte, onWarning func(err error)) []displaySet.ImageData {
+	t.Helper()
+
+	var images []displaySet.ImageData
+
+	err := NewPgsParser(WithLenientParsing(onWarning)).ParsePgsFromReader(bytes.NewReader(data), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		images = append(images, data)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return images
+}
+
+func TestLenientParsingWithoutWarningCallback(t *testing.T) {
+	var data []byte
+
+	data = append(data, testEpochStart(1, 0)...)
+	data = append(data, testNormal(2, 1, false)...)
+	// Invalid segment type
+	data = append(data, testSegment(3, 0x42, []byte{1, 2, 3})...)
+	data = append(data, testEpochStart(4, 2)...)
+	data = append(data, testNormal(5, 3, false)...)
+
+	images := parseLeniently(t, data, nil)
+
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+}
+
+func TestLenientParsingDiscardsDefinitionsOfBrokenDisplaySet(t *testing.T) {
+	var data []byte
+
+	data = append(data, testEpochStart(1, 0)...)
+	data = append(data, testNormal(2, 1, false)...)
+	// Redefines object 0 with palette entry 2, which is dark, then breaks before its END
+	data = append(data, testSegment(3, testPcs, testPcsPayload(2, 0, true))...)
+	data = append(data, testSegment(3, testOds, testOdsPayload(1, 2))...)
+	data = append(data, testSegment(3, 0x42, nil)...)
+	data = append(data, testNormal(4, 3, true)...)
+	data = append(data, testNormal(5, 4, false)...)
+
+	warnings := 0
+	images := parseLeniently(t, data, func(err error) {
+		warnings++
+	})
+
+	if warnings != 1 {
+		t.Fatalf("expected 1 warning, got %d", warnings)
+	}
+
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+
+	if expected, got := images[0].Image.At(0, 0), images[1].Image.At(0, 0); expected != got {
+		t.Fatalf("expected the object of the first epoch start in %v, got %v", expected, got)
+	}
+}
+
+func TestLenientParsingReportsTruncatedSegment(t *testing.T) {
+	var data []byte
+
+	data = append(data, testEpochStart(1, 0)...)
+	data = append(data, testNormal(2, 1, false)...)
+
+	// PCS whose size reaches past the end of the stream
+	corrupted := testEpochStart(3, 2)
+	corrupted[11], corrupted[12] = 0xFF, 0xFF
+	data = append(data, corrupted...)
+	data = append(data, testEpochStart(4, 3)...)
+	data = append(data, testNormal(5, 4, false)...)
+
+	var warnings []error
+	images := parseLeniently(t, data, func(err error) {
+		warnings = append(warnings, err)
+	})
+
+	if len(warnings) != 1 || !errors.Is(warnings[0], io.ErrUnexpectedEOF) {
+		t.Fatalf("expected a truncated segment warning, got %v", warnings)
+	}
+
+	// The display sets following the corrupted size are recovered
+	if len(images) != 2 || images[1].StartTime != 4*time.Second {
+		t.Fatalf("expected images at 1s and 4s, got %d images", len(images))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	pcs := segment.SegmentTypePcs
+	ods := segment.SegmentTypeOds
+	end := segment.SegmentTypeEnd
+
+	// Object 5 isn't defined
+	orphanFragment := testOdsPayload(0, 1)
+	orphanFragment[1] = 5
+	orphanFragment[3] = 0x40
+
+	// Reserved bits set in the flags of the composition object
+	invalidFlags := testPcsPayload(2, 0, true)
+	invalidFlags[14] = 0x01
+
+	// Segments following 2 valid display sets of 7 segments, the last one being broken
+	testCases := []struct {
+		name        string
+		segments    [][]byte
+		sentinel    error
+		segmentType *segment.SegmentType
+	}{
+		{"invalid magic number", [][]byte{append([]byte{'X'}, testSegment(3, testPcs, testPcsPayload(2, 0, false))[1:]...)}, displaySet.ErrInvalidMagicNumber, nil},
+		{"invalid segment type", [][]byte{testSegment(3, 0x42, []byte{1, 2, 3})}, segment.ErrInvalidSegmentType, nil},
+		{"END without PCS", [][]byte{testSegment(3, testEnd, nil)}, displaySet.ErrUnexpectedSegment, &end},
+		{"PCS before END", [][]byte{testSegment(3, testPcs, testPcsPayload(2, 0, false)), testSegment(3, testPcs, testPcsPayload(3, 0, false))}, displaySet.ErrUnexpectedSegment, &pcs},
+		{"ODS continuing an undefined object", [][]byte{testSegment(3, testPcs, testPcsPayload(2, 0, false)), testSegment(3, testOds, orphanFragment)}, displaySet.ErrUnexpectedObjectFragment, &ods},
+		{"invalid composition object flags", [][]byte{testSegment(3, testPcs, invalidFlags)}, segment.ErrInvalidObjectFlags, &pcs},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var data []byte
+
+			data = append(data, testEpochStart(1, 0)...)
+			data = append(data, testNormal(2, 1, false)...)
+
+			for _, broken := range testCase.segments[:len(testCase.segments)-1] {
+				data = append(data, broken...)
+			}
+
+			offset := int64(len(data))
+			segmentIndex := 7 + len(testCase.segments) - 1
+			data = append(data, testCase.segments[len(testCase.segments)-1]...)
+
+			err := NewPgsParser().ParseDisplaySetsFromReader(bytes.NewReader(data), func(data displaySet.DisplaySet, startTime time.Duration) error {
+				return nil
+			})
+
+			if !errors.Is(err, testCase.sentinel) {
+				t.Fatalf("expected %v, got %v", testCase.sentinel, err)
+			}
+
+			var parseError *displaySet.ParseError
+
+			if !errors.As(err, &parseError) {
+				t.Fatalf("expected a *displaySet.ParseError, got %T", err)
+			}
+
+			if parseError.Offset != offset || parseError.SegmentIndex != segmentIndex || parseError.DisplaySetIndex != 2 {
+				t.Fatalf("expected segment %d of display set 2 at offset %d, got segment %d of display set %d at offset %d",
+					segmentIndex, offset, parseError.SegmentIndex, parseError.DisplaySetIndex, parseError.Offset)
+			}
+
+			if (parseError.SegmentType == nil) != (testCase.segmentType == nil) ||
+				parseError.SegmentType != nil && *parseError.SegmentType != *testCase.segmentType {
+				t.Fatalf("expected segment type %v, got %v", testCase.segmentType, parseError.SegmentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+//go:build go1.23
+
+package pgs
+
+import (
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"io"
+	"iter"
+)
+
+// DisplaySetSeq Adapt an iterator to a range-over-func sequence. The sequence ends with the stream, or after yielding
+// an error other than io.EOF
+func DisplaySetSeq(iterator DisplaySetIterator) iter.Seq2[displaySet.DisplaySet, error] {
+	return func(yield func(displaySet.DisplaySet, error) bool) {
+		for {
+			set, err := iterator.Next()
+
+			if err == io.EOF {
+				return
+			}
+
+			if !yield(set, err) || err != nil {
+				return
+			}
+		}
+	}
+}
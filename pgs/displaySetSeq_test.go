@@ -0,0 +1,87 @@
+//go:build go1.23
+
+package pgs
+
+import (
+	"bytes"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"testing"
+)
+
+// countingIterator Iterator counting the calls to Next
+type countingIterator struct {
+	iterator DisplaySetIterator
+	calls    int
+}
+
+func (c *countingIterator) Next() (displaySet.DisplaySet, error) {
+	c.calls++
+
+	return c.iterator.Next()
+}
+
+func TestDisplaySetSeq(t *testing.T) {
+	data := testIteratorStream()
+	expected := parsedDisplaySetKeys(t, data)
+
+	var keys []testDisplaySetKey
+
+	for set, err := range DisplaySetSeq(NewPgsParser().IterateDisplaySets(bytes.NewReader(data))) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys = append(keys, displaySetKey(set))
+	}
+
+	expectDisplaySetKeys(t, expected, keys)
+}
+
+func TestDisplaySetSeqStopsReadingOnBreak(t *testing.T) {
+	reader := &countingReader{reader: newSyntheticStream(t, 100)}
+	iterator := &countingIterator{iterator: NewPgsParser().IterateDisplaySets(reader)}
+
+	for _, err := range DisplaySetSeq(iterator) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		break
+	}
+
+	if iterator.calls != 1 {
+		t.Fatalf("expected a single display set to be pulled, got %d", iterator.calls)
+	}
+
+	// A few chunks at most, the stream being several MB long
+	if reader.read > 4*readChunkSize {
+		t.Fatalf("expected reading to stop after the first display set, got %d bytes read", reader.read)
+	}
+}
+
+func TestDisplaySetSeqEndsWithError(t *testing.T) {
+	data := testEpochStart(1, 0)
+	// Invalid segment type
+	data = append(data, testSegment(2, 0x42, []byte{1, 2, 3})...)
+	data = append(data, testEpochStart(3, 1)...)
+
+	var errs []error
+	displaySets := 0
+
+	for set, err := range DisplaySetSeq(NewPgsParser().IterateDisplaySets(bytes.NewReader(data))) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if set == nil {
+			t.Fatal("expected a display set along with a nil error")
+		}
+
+		displaySets++
+	}
+
+	if displaySets != 1 || len(errs) != 1 {
+		t.Fatalf("expected 1 display set then 1 error ending the sequence, got %d display sets and errors %v", displaySets, errs)
+	}
+}
@@ -0,0 +1,127 @@
+package pgs
+
+import (
+	"bytes"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"time"
+)
+
+// LastImageDuration Duration given to the last image of a stream when no display set clears it
+const LastImageDuration = 5 * time.Second
+
+// imageTimeline Holds back each image until the display set clearing or replacing it is known, to fill its end time
+type imageTimeline struct {
+	pending *displaySet.ImageData
+
+	// pendingSet Display set the pending image was rendered from
+	pendingSet displaySet.DisplaySet
+}
+
+func newImageTimeline() *imageTimeline {
+	return &imageTimeline{}
+}
+
+// push Handle the next display set and its image, and return the image it ends if any
+func (t *imageTimeline) push(data displaySet.DisplaySet, imageData *displaySet.ImageData) *displaySet.ImageData {
+	var ended *displaySet.ImageData
+
+	if t.pending != nil && imageData != nil && data.CompositionState() != segment.CompositionStateEpochStart &&
+		sameContent(t.pendingSet, data) {
+		// e.g. an acquisition point showing the pending subtitle again, which is still the same image
+		return nil
+	}
+
+	clears := len(data.CompositionObjects()) == 0 || data.CompositionState() == segment.CompositionStateEpochStart
+
+	if t.pending != nil && (clears || imageData != nil) {
+		ended = t.pending
+		ended.EndTime = data.StartTime()
+		t.pending = nil
+		t.pendingSet = nil
+	}
+
+	if imageData != nil {
+		t.pending = imageData
+		t.pendingSet = data
+	}
+
+	return ended
+}
+
+// flush Return the image still displayed at the end of the stream if any
+func (t *imageTimeline) flush() *displaySet.ImageData {
+	ended := t.pending
+
+	if ended != nil {
+		ended.EndTime = ended.StartTime + LastImageDuration
+		t.pending = nil
+		t.pendingSet = nil
+	}
+
+	return ended
+}
+
+// sameContent Whether two display sets show the same objects at the same positions, with the same data and palette
+func sameContent(a displaySet.DisplaySet, b displaySet.DisplaySet) bool {
+	aObjects := a.CompositionObjects()
+	bObjects := b.CompositionObjects()
+
+	if len(aObjects) != len(bObjects) {
+		return false
+	}
+
+	for i := range aObjects {
+		if aObjects[i] != bObjects[i] {
+			return false
+		}
+
+		aObject := a.Object(aObjects[i].ObjectId)
+		bObject := b.Object(bObjects[i].ObjectId)
+
+		if aObject == nil || bObject == nil {
+			return false
+		}
+
+		if aObject.Width != bObject.Width || aObject.Height != bObject.Height || !bytes.Equal(aObject.Data(), bObject.Data()) {
+			return false
+		}
+	}
+
+	aWindows := a.Windows()
+	bWindows := b.Windows()
+
+	if len(aWindows) != len(bWindows) {
+		return false
+	}
+
+	for i := range aWindows {
+		if aWindows[i] != bWindows[i] {
+			return false
+		}
+	}
+
+	aPalette, err := a.Palette()
+
+	if err != nil {
+		return false
+	}
+
+	bPalette, err := b.Palette()
+
+	if err != nil {
+		return false
+	}
+
+	if len(aPalette.PaletteEntries) != len(bPalette.PaletteEntries) {
+		return false
+	}
+
+	for i := range aPalette.PaletteEntries {
+		if aPalette.PaletteEntries[i] != bPalette.PaletteEntries[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,159 @@
+package pgs
+
+import (
+	"bytes"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"testing"
+	"time"
+)
+
+// testAcquisitionPoint Display set redefining the palette and object 0 filled with the given palette entry, and showing it
+func testAcquisitionPoint(second int, compositionNumber int, version byte, paletteEntry byte) []byte {
+	var data []byte
+
+	data = append(data, testSegment(second, testPcs, testPcsPayload(compositionNumber, 0x40, true))...)
+	data = append(data, testSegment(second, testWds, []byte{1, 0, 0x03, 0x00, 0x03, 0x84, 0, 20, 0, 10})...)
+	data = append(data, testSegment(second, testPds, []byte{0, 0, 1, 235, 128, 128, 255, 2, 16, 128, 128, 255})...)
+	data = append(data, testSegment(second, testOds, testOdsPayload(version, paletteEntry))...)
+
+	return append(data, testSegment(second, testEnd, nil)...)
+}
+
+func TestImageTimelineExtendsUnchangedImage(t *testing.T) {
+	type interval struct {
+		start time.Duration
+		end   time.Duration
+	}
+
+	testCases := []struct {
+		name     string
+		data     [][]byte
+		expected []interval
+	}{
+		{
+			name: "acquisition point with the same object",
+			data: [][]byte{
+				testEpochStart(1, 0),
+				testAcquisitionPoint(2, 1, 1, 1),
+				testNormal(3, 2, false),
+			},
+			expected: []interval{{time.Second, 3 * time.Second}},
+		},
+		{
+			name: "normal display set showing the same object",
+			data: [][]byte{
+				testEpochStart(1, 0),
+				testNormal(2, 1, true),
+				testNormal(3, 2, true),
+				testNormal(4, 3, false),
+			},
+			expected: []interval{{time.Second, 4 * time.Second}},
+		},
+		{
+			name: "acquisition point with another object",
+			data: [][]byte{
+				testEpochStart(1, 0),
+				testAcquisitionPoint(2, 1, 1, 2),
+				testNormal(3, 2, false),
+			},
+			expected: []interval{{time.Second, 2 * time.Second}, {2 * time.Second, 3 * time.Second}},
+		},
+		{
+			name: "epoch start with the same object",
+			data: [][]byte{
+				testEpochStart(1, 0),
+				testEpochStart(2, 1),
+				testNormal(3, 2, false),
+			},
+			expected: []interval{{time.Second, 2 * time.Second}, {2 * time.Second, 3 * time.Second}},
+		},
+		{
+			name: "same object shown again after a clear",
+			data: [][]byte{
+				testEpochStart(1, 0),
+				testNormal(2, 1, false),
+				testNormal(3, 2, true),
+				testNormal(4, 3, false),
+			},
+			expected: []interval{{time.Second, 2 * time.Second}, {3 * time.Second, 4 * time.Second}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		for _, workers := range []int{1, 4} {
+			var images []interval
+
+			err := NewPgsParser(WithWorkers(workers)).ParsePgsFromReader(bytes.NewReader(bytes.Join(testCase.data, nil)), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+				images = append(images, interval{data.StartTime, data.EndTime})
+
+				return nil
+			})
+
+			if err != nil {
+				t.Fatalf("%s: %v", testCase.name, err)
+			}
+
+			if len(images) != len(testCase.expected) {
+				t.Fatalf("%s with %d workers: expected images %v, got %v", testCase.name, workers, testCase.expected, images)
+			}
+
+			for i := range images {
+				if images[i] != testCase.expected[i] {
+					t.Fatalf("%s with %d workers: expected images %v, got %v", testCase.name, workers, testCase.expected, images)
+				}
+			}
+		}
+	}
+}
+
+func TestImageTimelineReportsPaletteUpdate(t *testing.T) {
+	var data []byte
+
+	data = append(data, testEpochStart(1, 0)...)
+
+	// Palette update without composition objects, redefining palette entry 1 as dark
+	paletteUpdate := testPcsPayload(1, 0, false)
+	paletteUpdate[8] = 0x80
+	data = append(data, testSegment(2, testPcs, paletteUpdate)...)
+	data = append(data, testSegment(2, testPds, []byte{0, 1, 1, 16, 128, 128, 255})...)
+	data = append(data, testSegment(2, testEnd, nil)...)
+
+	data = append(data, testNormal(3, 2, false)...)
+
+	var images []displaySet.ImageData
+
+	err := NewPgsParser().ParsePgsFromReader(bytes.NewReader(data), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		images = append(images, data)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+
+	if images[0].EndTime != 2*time.Second || images[1].StartTime != 2*time.Second || images[1].EndTime != 3*time.Second {
+		t.Fatalf("expected the palette update to replace the first image at 2s until 3s, got %v-%v and %v-%v",
+			images[0].StartTime, images[0].EndTime, images[1].StartTime, images[1].EndTime)
+	}
+
+	if images[0].PaletteUpdate || !images[1].PaletteUpdate {
+		t.Fatalf("expected only the second image to be a palette update, got %t and %t", images[0].PaletteUpdate, images[1].PaletteUpdate)
+	}
+
+	if images[1].X != images[0].X || images[1].Y != images[0].Y || images[1].Width != images[0].Width || images[1].Height != images[0].Height {
+		t.Fatal("expected the palette update to keep the bounds of the first image")
+	}
+
+	if r, _, _, _ := images[0].Image.At(0, 0).RGBA(); r>>8 != 235 {
+		t.Fatalf("expected a light first image, got %v", images[0].Image.At(0, 0))
+	}
+
+	if r, _, _, _ := images[1].Image.At(0, 0).RGBA(); r>>8 != 16 {
+		t.Fatalf("expected a dark palette update, got %v", images[1].Image.At(0, 0))
+	}
+}
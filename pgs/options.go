@@ -0,0 +1,79 @@
+package pgs
+
+import "github.com/mbiamont/go-pgs-parser/displaySet"
+
+// Option Configure a PgsParser
+type Option func(parser *pgsParser)
+
+// WithFullCanvas Render each subtitle on a transparent image the size of the video frame, with the objects at their position,
+// so that it can be laid directly over a video frame
+func WithFullCanvas() Option {
+	return func(parser *pgsParser) {
+		parser.renderOptions.FullCanvas = true
+	}
+}
+
+// WithColorConversion Convert palettes from YCbCr to RGB with the given matrix and range, producing *image.NRGBA images,
+// instead of the default BT.601 approximation producing *image.RGBA images.
+// HD Blu-ray subtitles are usually BT.709 limited range and UHD ones BT.2020 limited range
+func WithColorConversion(matrix displaySet.ColorMatrix, colorRange displaySet.ColorRange) Option {
+	return func(parser *pgsParser) {
+		parser.renderOptions.ColorConversion = &displaySet.ColorConversion{
+			Matrix: matrix,
+			Range:  colorRange,
+		}
+	}
+}
+
+// WithPalettedImages Produce *image.Paletted images indexed by the PGS palette entry ids, which are smaller to encode
+// as PNG and keep the original palette indices
+func WithPalettedImages() Option {
+	return func(parser *pgsParser) {
+		parser.renderOptions.Paletted = true
+	}
+}
+
+// WithMkvTrack Parse the PGS track with the given track number when reading a Matroska file, instead of its first PGS track
+func WithMkvTrack(trackNumber int) Option {
+	return func(parser *pgsParser) {
+		parser.mkvTrack = trackNumber
+	}
+}
+
+// WithTsPid Parse the PGS stream with the given PID when reading a transport stream, instead of its first PGS stream
+func WithTsPid(pid int) Option {
+	return func(parser *pgsParser) {
+		parser.tsPid = pid
+	}
+}
+
+// WithLenientParsing Skip corrupted data instead of failing: on a parse error, the display set being parsed is discarded,
+// parsing resumes at the next segment header found and onWarning is called with the error, unless it's nil.
+// Display sets which can't be rendered are skipped as well
+func WithLenientParsing(onWarning func(err error)) Option {
+	return func(parser *pgsParser) {
+		if onWarning == nil {
+			onWarning = func(err error) {}
+		}
+
+		parser.lenient = true
+		parser.onWarning = onWarning
+	}
+}
+
+// WithWorkers Render display sets and encode images on the given number of goroutines instead of one.
+// Callbacks are still called one at a time in index order, while the images of ConvertTo*Images are encoded
+// concurrently once their file is created. The first error returned by a worker or a callback stops the others
+func WithWorkers(workers int) Option {
+	return func(parser *pgsParser) {
+		parser.workers = workers
+	}
+}
+
+// WithUnorderedCallbacks With WithWorkers, call onImage and fileCreator from the workers as soon as each image is
+// rendered, concurrently and in any order, instead of one at a time in index order. Indices are left unchanged
+func WithUnorderedCallbacks() Option {
+	return func(parser *pgsParser) {
+		parser.unordered = true
+	}
+}
@@ -1,16 +1,19 @@
 package pgs
 
 import (
-	"github.com/mbiamont/go-pgs-parser/buffer"
+	"context"
 	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"image"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"os"
 	"time"
 )
 
 type PgsParser interface {
-	// ParsePgsFile Parse the input file path and call the onImage function for each ImageData found
+	// ParsePgsFile Parse the input file path, a SUP, Matroska or transport stream file, and call the onImage function for each ImageData found.
+	// Each image is reported once the display set clearing or replacing it is parsed, so that its EndTime is known
 	ParsePgsFile(inputFilePath string, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error
 
 	// ParseDisplaySets Parse the input file path and call the onDisplaySet function for each DisplaySet found
@@ -21,111 +24,248 @@ type PgsParser interface {
 
 	// ConvertToJpgImages Parse the input file path and save each subtitle picture as a JPG using fileCreator function to create the JPG file
 	ConvertToJpgImages(inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error
+
+	// ParsePgsFromReader Parse the SUP stream read from reader and call the onImage function for each ImageData found
+	ParsePgsFromReader(reader io.Reader, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error
+
+	// ParseDisplaySetsFromReader Parse the SUP stream read from reader and call the onDisplaySet function for each DisplaySet found
+	ParseDisplaySetsFromReader(reader io.Reader, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error
+
+	// ConvertToPngImagesFromReader Parse the SUP stream read from reader and save each subtitle picture as a PNG using fileCreator function to create the PNG file
+	ConvertToPngImagesFromReader(reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error
+
+	// ConvertToJpgImagesFromReader Parse the SUP stream read from reader and save each subtitle picture as a JPG using fileCreator function to create the JPG file
+	ConvertToJpgImagesFromReader(reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error
+
+	// ParsePgsFileContext ParsePgsFile stopping with ctx.Err() once the context is done
+	ParsePgsFileContext(ctx context.Context, inputFilePath string, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error
+
+	// ParseDisplaySetsContext ParseDisplaySets stopping with ctx.Err() once the context is done
+	ParseDisplaySetsContext(ctx context.Context, inputFilePath string, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error
+
+	// ConvertToPngImagesContext ConvertToPngImages stopping with ctx.Err() once the context is done
+	ConvertToPngImagesContext(ctx context.Context, inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error
+
+	// ConvertToJpgImagesContext ConvertToJpgImages stopping with ctx.Err() once the context is done
+	ConvertToJpgImagesContext(ctx context.Context, inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error
+
+	// ParsePgsFromReaderContext ParsePgsFromReader stopping with ctx.Err() once the context is done
+	ParsePgsFromReaderContext(ctx context.Context, reader io.Reader, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error
+
+	// ParseDisplaySetsFromReaderContext ParseDisplaySetsFromReader stopping with ctx.Err() once the context is done
+	ParseDisplaySetsFromReaderContext(ctx context.Context, reader io.Reader, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error
+
+	// ConvertToPngImagesFromReaderContext ConvertToPngImagesFromReader stopping with ctx.Err() once the context is done
+	ConvertToPngImagesFromReaderContext(ctx context.Context, reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error
+
+	// ConvertToJpgImagesFromReaderContext ConvertToJpgImagesFromReader stopping with ctx.Err() once the context is done
+	ConvertToJpgImagesFromReaderContext(ctx context.Context, reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error
+
+	// IterateDisplaySets Iterate over the display sets of the stream read from reader, one Next call at a time
+	IterateDisplaySets(reader io.Reader) DisplaySetIterator
+
+	// IterateDisplaySetsContext IterateDisplaySets stopping with ctx.Err() once the context is done
+	IterateDisplaySetsContext(ctx context.Context, reader io.Reader) DisplaySetIterator
 }
 
 type pgsParser struct {
+	renderOptions displaySet.RenderOptions
+	mkvTrack      int
+	tsPid         int
+
+	// workers Number of goroutines rendering and encoding images, unordered calling the callbacks from them
+	workers   int
+	unordered bool
+
+	// lenient Whether errors are skipped, onWarning being called with them
+	lenient   bool
+	onWarning func(err error)
 }
 
 // NewPgsParser Initialize a new PGS parser
-func NewPgsParser() PgsParser {
-	return &pgsParser{}
+func NewPgsParser(options ...Option) PgsParser {
+	parser := &pgsParser{}
+
+	for _, option := range options {
+		option(parser)
+	}
+
+	return parser
 }
 
 func (p *pgsParser) ParsePgsFile(inputFilePath string, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error {
-	i := 0
-	return p.ParseDisplaySets(inputFilePath, func(data displaySet.DisplaySet, startTime time.Duration) error {
-		imageData, err := data.ToImageData()
+	return p.ParsePgsFileContext(context.Background(), inputFilePath, onImage)
+}
 
-		if err != nil {
-			return err
-		} else if imageData != nil {
-			err = onImage(i, startTime, *imageData)
+func (p *pgsParser) ParseDisplaySets(inputFilePath string, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error {
+	return p.ParseDisplaySetsContext(context.Background(), inputFilePath, onDisplaySet)
+}
 
-			if err != nil {
-				return err
-			}
-			i++
-		}
-		return nil
-	})
+func (p *pgsParser) ConvertToPngImages(inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	return p.ConvertToPngImagesContext(context.Background(), inputFilePath, fileCreator)
 }
 
-func (p *pgsParser) ParseDisplaySets(inputFilePath string, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error {
-	file, err := os.ReadFile(inputFilePath)
+func (p *pgsParser) ConvertToJpgImages(inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	return p.ConvertToJpgImagesContext(context.Background(), inputFilePath, fileCreator)
+}
+
+func (p *pgsParser) ParsePgsFromReader(reader io.Reader, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error {
+	return p.ParsePgsFromReaderContext(context.Background(), reader, onImage)
+}
+
+func (p *pgsParser) ParseDisplaySetsFromReader(reader io.Reader, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error {
+	return p.ParseDisplaySetsFromReaderContext(context.Background(), reader, onDisplaySet)
+}
+
+func (p *pgsParser) ConvertToPngImagesFromReader(reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	return p.ConvertToPngImagesFromReaderContext(context.Background(), reader, fileCreator)
+}
+
+func (p *pgsParser) ConvertToJpgImagesFromReader(reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	return p.ConvertToJpgImagesFromReaderContext(context.Background(), reader, fileCreator)
+}
+
+func (p *pgsParser) IterateDisplaySets(reader io.Reader) DisplaySetIterator {
+	return p.IterateDisplaySetsContext(context.Background(), reader)
+}
+
+func (p *pgsParser) IterateDisplaySetsContext(ctx context.Context, reader io.Reader) DisplaySetIterator {
+	return newDisplaySetIterator(ctx, p, reader)
+}
+
+func (p *pgsParser) ParsePgsFileContext(ctx context.Context, inputFilePath string, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error {
+	file, err := os.Open(inputFilePath)
 
 	if err != nil {
 		return err
 	}
 
-	parser := displaySet.NewDisplaySetParser()
-	accumulatedBuffer := buffer.NewCompositeBufferReader()
-	requestedBytes := 13
+	defer file.Close()
 
-	accumulatedBuffer.Add(file)
+	return p.ParsePgsFromReaderContext(ctx, file, onImage)
+}
 
-	for accumulatedBuffer.Length() >= requestedBytes {
-		bytes, err := accumulatedBuffer.ReadBytes(requestedBytes)
+func (p *pgsParser) ParseDisplaySetsContext(ctx context.Context, inputFilePath string, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error {
+	file, err := os.Open(inputFilePath)
 
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return err
+	}
 
-		requestedBytes, err = parser.Consume(bytes)
+	defer file.Close()
 
-		if err != nil {
-			return err
-		}
+	return p.ParseDisplaySetsFromReaderContext(ctx, file, onDisplaySet)
+}
 
-		if parser.IsReady() {
-			ds := parser.Next()
-			if ds != nil {
-				set := *ds
-				err = onDisplaySet(set, set.StartTime())
+func (p *pgsParser) ConvertToPngImagesContext(ctx context.Context, inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	file, err := os.Open(inputFilePath)
 
-				if err != nil {
-					return err
-				}
-			}
-		}
+	if err != nil {
+		return err
 	}
 
-	return nil
+	defer file.Close()
+
+	return p.ConvertToPngImagesFromReaderContext(ctx, file, fileCreator)
 }
 
-func (p *pgsParser) ConvertToPngImages(inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
-	return p.ParsePgsFile(inputFilePath, func(index int, startTime time.Duration, data displaySet.ImageData) error {
-		f, err := fileCreator(index, startTime)
+func (p *pgsParser) ConvertToJpgImagesContext(ctx context.Context, inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	file, err := os.Open(inputFilePath)
 
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return err
+	}
 
-		defer f.Close()
+	defer file.Close()
 
-		if err != nil {
-			return err
+	return p.ConvertToJpgImagesFromReaderContext(ctx, file, fileCreator)
+}
+
+func (p *pgsParser) ParsePgsFromReaderContext(ctx context.Context, reader io.Reader, onImage func(index int, startTime time.Duration, data displaySet.ImageData) error) error {
+	return p.parseImages(ctx, reader, func(index int, startTime time.Duration, data displaySet.ImageData) (imageTask, error) {
+		if !p.unordered {
+			return nil, onImage(index, startTime, data)
 		}
 
-		return png.Encode(f, data.Image)
+		return func(ctx context.Context) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			return onImage(index, startTime, data)
+		}, nil
 	})
 }
 
-func (p *pgsParser) ConvertToJpgImages(inputFilePath string, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
-	return p.ParsePgsFile(inputFilePath, func(index int, startTime time.Duration, data displaySet.ImageData) error {
-		f, err := fileCreator(index, startTime)
+func (p *pgsParser) ParseDisplaySetsFromReaderContext(ctx context.Context, reader io.Reader, onDisplaySet func(data displaySet.DisplaySet, startTime time.Duration) error) error {
+	iterator := p.IterateDisplaySetsContext(ctx, reader)
+
+	for {
+		set, err := iterator.Next()
+
+		if err == io.EOF {
+			return nil
+		}
 
 		if err != nil {
 			return err
 		}
 
-		defer f.Close()
+		err = onDisplaySet(set, set.StartTime())
 
 		if err != nil {
 			return err
 		}
+	}
+}
 
-		return jpeg.Encode(f, data.Image, &jpeg.Options{
+func (p *pgsParser) ConvertToPngImagesFromReaderContext(ctx context.Context, reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	return p.encodeImages(ctx, reader, fileCreator, png.Encode)
+}
+
+func (p *pgsParser) ConvertToJpgImagesFromReaderContext(ctx context.Context, reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error)) error {
+	return p.encodeImages(ctx, reader, fileCreator, func(w io.Writer, m image.Image) error {
+		return jpeg.Encode(w, m, &jpeg.Options{
 			Quality: 100,
 		})
 	})
 }
+
+// encodeImages Save each image in the file created by fileCreator, the files being created in index order unless unordered
+func (p *pgsParser) encodeImages(ctx context.Context, reader io.Reader, fileCreator func(index int, startTime time.Duration) (*os.File, error), encode func(w io.Writer, m image.Image) error) error {
+	return p.parseImages(ctx, reader, func(index int, startTime time.Duration, data displaySet.ImageData) (imageTask, error) {
+		var f *os.File
+
+		if !p.unordered {
+			var err error
+			f, err = fileCreator(index, startTime)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return func(ctx context.Context) error {
+			if f == nil {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				var err error
+				f, err = fileCreator(index, startTime)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			defer f.Close()
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			return encode(f, data.Image)
+		}, nil
+	})
+}
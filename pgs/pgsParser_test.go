@@ -0,0 +1,282 @@
+package pgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"image"
+	"image/color"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subtitleInterval Time between the start of two subtitles of the synthetic stream
+const subtitleInterval = 3 * time.Second
+
+// syntheticStream Stream of count subtitles, each one shown then cleared, generated while being read
+type syntheticStream struct {
+	template []byte
+	count    int
+	index    int
+	pending  []byte
+}
+
+// newSyntheticStream Encode a single subtitle, which is repeated count times with shifted timestamps
+func newSyntheticStream(t testing.TB, count int) io.Reader {
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 100))
+
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 400; x++ {
+			// Noisy enough to make large objects
+			if (x*7+y*13)%5 < 2 {
+				img.SetNRGBA(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+			} else if (x+y)%3 == 0 {
+				img.SetNRGBA(x, y, color.NRGBA{A: 255})
+			}
+		}
+	}
+
+	var template bytes.Buffer
+
+	err := NewSupEncoder(1920, 1080, displaySet.ColorConversion{}).Encode(&template, []Subtitle{
+		{Image: img, StartTime: 0, EndTime: 2 * time.Second, X: 760, Y: 900},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &syntheticStream{
+		template: template.Bytes(),
+		count:    count,
+	}
+}
+
+func (s *syntheticStream) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		if s.index == s.count {
+			return 0, io.EOF
+		}
+
+		s.pending = s.shifted(uint32(time.Duration(s.index) * subtitleInterval * 90000 / time.Second))
+		s.index++
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+
+	return n, nil
+}
+
+// shifted Copy of the template with the timestamps of its segments shifted by offset, in 90kHz units
+func (s *syntheticStream) shifted(offset uint32) []byte {
+	data := append([]byte(nil), s.template...)
+
+	for i := 0; i+segmentHeaderLength <= len(data); {
+		presentationTimestamp := binary.BigEndian.Uint32(data[i+2:])
+		binary.BigEndian.PutUint32(data[i+2:], presentationTimestamp+offset)
+
+		if decodingTimestamp := binary.BigEndian.Uint32(data[i+6:]); decodingTimestamp != 0 {
+			binary.BigEndian.PutUint32(data[i+6:], decodingTimestamp+offset)
+		}
+
+		i += segmentHeaderLength + int(binary.BigEndian.Uint16(data[i+11:]))
+	}
+
+	return data
+}
+
+// heapAlloc Bytes allocated on the heap once garbage collected
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+
+	return stats.HeapAlloc
+}
+
+func TestParseLongStreamInBoundedMemory(t *testing.T) {
+	// 4 hours of subtitles, each with an object of about 20kB
+	const subtitles = 4 * 3600 / 3
+	const sampleInterval = 500
+	// Keeping every display set alive would add several tens of MB
+	const maxGrowth = 4 * 1024 * 1024
+
+	var samples []uint64
+	displaySets := 0
+
+	err := NewPgsParser().ParseDisplaySetsFromReader(newSyntheticStream(t, subtitles), func(data displaySet.DisplaySet, startTime time.Duration) error {
+		if displaySets%sampleInterval == 0 {
+			samples = append(samples, heapAlloc())
+		}
+		displaySets++
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if displaySets != 2*subtitles {
+		t.Fatalf("expected %d display sets, got %d", 2*subtitles, displaySets)
+	}
+
+	for i, sample := range samples[1:] {
+		if sample > samples[0]+maxGrowth {
+			t.Fatalf("heap grew from %d to %d bytes after %d display sets", samples[0], sample, (i+1)*sampleInterval)
+		}
+	}
+}
+
+func TestImageTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   []Option
+		imageType string
+	}{
+		{"default", nil, "*image.RGBA"},
+		{"color conversion", []Option{WithColorConversion(displaySet.ColorMatrixBt709, displaySet.ColorRangeLimited)}, "*image.NRGBA"},
+		{"paletted", []Option{WithPalettedImages()}, "*image.Paletted"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			images := 0
+
+			err := NewPgsParser(test.options...).ParsePgsFromReader(newSyntheticStream(t, 2), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+				if imageType := fmt.Sprintf("%T", data.Image); imageType != test.imageType {
+					t.Errorf("expected %s, got %s", test.imageType, imageType)
+				}
+				images++
+
+				return nil
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if images != 2 {
+				t.Fatalf("expected 2 images, got %d", images)
+			}
+		})
+	}
+}
+
+func BenchmarkParsePgsFromReader(b *testing.B) {
+	// About 50 MB of subtitles
+	template, err := io.ReadAll(newSyntheticStream(b, 1))
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	stream, err := io.ReadAll(newSyntheticStream(b, 50*1000*1000/len(template)))
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	parser := NewPgsParser()
+
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := parser.ParsePgsFromReader(bytes.NewReader(stream), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+			return nil
+		})
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseWithCancelledContext(t *testing.T) {
+	var data []byte
+
+	data = append(data, testEpochStart(1, 0)...)
+	data = append(data, testNormal(2, 1, false)...)
+	// Offset of the display set following the cancellation
+	offset := len(data)
+	data = append(data, testEpochStart(3, 2)...)
+	data = append(data, testNormal(4, 3, false)...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	displaySets := 0
+
+	err := NewPgsParser().ParseDisplaySetsFromReaderContext(ctx, bytes.NewReader(data), func(data displaySet.DisplaySet, startTime time.Duration) error {
+		displaySets++
+
+		if displaySets == 2 {
+			cancel()
+		}
+
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if !strings.Contains(err.Error(), fmt.Sprintf("offset %d", offset)) {
+		t.Fatalf("expected the error to name offset %d, got %v", offset, err)
+	}
+
+	if displaySets != 2 {
+		t.Fatalf("expected parsing to stop after 2 display sets, got %d", displaySets)
+	}
+}
+
+func TestParseImagesWithCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, workers := range []int{1, 4} {
+		images := 0
+
+		err := NewPgsParser(WithWorkers(workers)).ParsePgsFromReaderContext(ctx, newSyntheticStream(t, 10), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+			images++
+
+			return nil
+		})
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%d workers: expected %v, got %v", workers, context.Canceled, err)
+		}
+
+		if images != 0 {
+			t.Fatalf("%d workers: expected no image, got %d", workers, images)
+		}
+	}
+}
+
+func TestRenderWithCancelledContext(t *testing.T) {
+	iterator := NewPgsParser().IterateDisplaySets(newSyntheticStream(t, 1))
+	set, err := iterator.Next()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = set.ToImageDataContext(ctx, displaySet.RenderOptions{})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,235 @@
+package pgs
+
+import (
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"image"
+	"io"
+	"os"
+	"time"
+)
+
+// Subtitle Bitmap subtitle to encode as PGS
+type Subtitle struct {
+	Image     image.Image
+	StartTime time.Duration
+	EndTime   time.Duration
+
+	// X Horizontal position of the image on the video frame
+	X int
+	// Y Vertical position of the image on the video frame
+	Y int
+
+	// Forced Display the image even when subtitles are turned off (e.g. to translate a sign)
+	Forced bool
+}
+
+type SupEncoder interface {
+	// Encode Write the subtitles as a SUP stream, each one displayed in its own epoch and cleared at its end time
+	Encode(writer io.Writer, subtitles []Subtitle) error
+
+	// EncodeToFile Write the subtitles as a SUP file at the output file path
+	EncodeToFile(outputFilePath string, subtitles []Subtitle) error
+}
+
+type supEncoder struct {
+	videoWidth      int
+	videoHeight     int
+	colorConversion displaySet.ColorConversion
+	frameRate       float64
+}
+
+// SupEncoderOption Configure a SupEncoder
+type SupEncoderOption func(encoder *supEncoder)
+
+// WithEncoderFrameRate Write the given video frame rate in the composition segments instead of 23.976.
+// It must be one of the frame rates defined by PGS: 23.976, 24, 25, 29.97, 50 or 59.94
+func WithEncoderFrameRate(frameRate float64) SupEncoderOption {
+	return func(encoder *supEncoder) {
+		encoder.frameRate = frameRate
+	}
+}
+
+// NewSupEncoder Initialize a new encoder of subtitles for a video of the given size.
+// Colors are converted to YCbCr with the given conversion, ColorMatrixAuto picking the matrix from the video height
+func NewSupEncoder(videoWidth int, videoHeight int, colorConversion displaySet.ColorConversion, options ...SupEncoderOption) SupEncoder {
+	encoder := &supEncoder{
+		videoWidth:      videoWidth,
+		videoHeight:     videoHeight,
+		colorConversion: colorConversion,
+		frameRate:       24000.0 / 1001,
+	}
+
+	for _, option := range options {
+		option(encoder)
+	}
+
+	return encoder
+}
+
+func (e *supEncoder) EncodeToFile(outputFilePath string, subtitles []Subtitle) error {
+	file, err := os.Create(outputFilePath)
+
+	if err != nil {
+		return err
+	}
+
+	err = e.Encode(file, subtitles)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (e *supEncoder) Encode(writer io.Writer, subtitles []Subtitle) error {
+	frameRate, err := segment.NewSegmentMapper().FromFrameRate(e.frameRate)
+
+	if err != nil {
+		return err
+	}
+
+	supWriter := NewSupWriter(writer)
+	compositionNumber := 0
+
+	for i, subtitle := range subtitles {
+		if subtitle.EndTime <= subtitle.StartTime {
+			return fmt.Errorf("subtitle %d ends before it starts", i)
+		}
+
+		if i > 0 && subtitle.StartTime < subtitles[i-1].EndTime {
+			return fmt.Errorf("subtitle %d starts before the end of the previous one", i)
+		}
+
+		err := e.encodeSubtitle(supWriter, subtitle, compositionNumber, int(frameRate))
+
+		if err != nil {
+			return err
+		}
+
+		compositionNumber = (compositionNumber + 2) % 65536
+	}
+
+	return nil
+}
+
+// encodeSubtitle Write an epoch start display set showing the subtitle, and a display set clearing it at its end time
+func (e *supEncoder) encodeSubtitle(supWriter SupWriter, subtitle Subtitle, compositionNumber int, frameRate int) error {
+	bounds := subtitle.Image.Bounds()
+
+	if bounds.Empty() {
+		return fmt.Errorf("subtitle at %s has an empty image", subtitle.StartTime)
+	}
+
+	if subtitle.X < 0 || subtitle.Y < 0 || subtitle.X+bounds.Dx() > e.videoWidth || subtitle.Y+bounds.Dy() > e.videoHeight {
+		return fmt.Errorf("subtitle at %s doesn't fit in the %dx%d video frame", subtitle.StartTime, e.videoWidth, e.videoHeight)
+	}
+
+	paletted := displaySet.Quantize(subtitle.Image)
+	conversion := e.colorConversion.Resolve(e.videoHeight)
+
+	window := segment.WindowDefinition{
+		WindowId:                 0,
+		WindowHorizontalPosition: subtitle.X,
+		WindowVerticalPosition:   subtitle.Y,
+		WindowWidth:              bounds.Dx(),
+		WindowHeight:             bounds.Dy(),
+	}
+
+	startHeader := e.header(subtitle.StartTime)
+	endHeader := e.header(subtitle.EndTime)
+
+	err := supWriter.WritePcsSegment(segment.PresentationCompositionSegment{
+		Width:                  e.videoWidth,
+		Height:                 e.videoHeight,
+		FrameRate:              frameRate,
+		CompositionNumber:      compositionNumber,
+		CompositionState:       segment.CompositionStateEpochStart,
+		PaletteId:              0,
+		CompositionObjectCount: 1,
+		CompositionObjects: []segment.CompositionObject{
+			{
+				ObjectId:                 0,
+				WindowId:                 window.WindowId,
+				ObjectHorizontalPosition: subtitle.X,
+				ObjectVerticalPosition:   subtitle.Y,
+				ObjectForcedOnFlag:       subtitle.Forced,
+			},
+		},
+		Segment: segment.Segment{Header: startHeader},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = e.writeWindow(supWriter, startHeader, window)
+
+	if err != nil {
+		return err
+	}
+
+	err = supWriter.WritePdsSegment(segment.PaletteDefinitionSegment{
+		PaletteId:            0,
+		PaletteVersionNumber: 0,
+		PaletteEntries:       displaySet.PaletteEntries(paletted.Palette, conversion),
+		Segment:              segment.Segment{Header: startHeader},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = supWriter.WriteObject(startHeader, 0, 0, bounds.Dx(), bounds.Dy(), displaySet.RleEncode(paletted))
+
+	if err != nil {
+		return err
+	}
+
+	err = supWriter.WriteEndSegment(segment.Segment{Header: startHeader})
+
+	if err != nil {
+		return err
+	}
+
+	err = supWriter.WritePcsSegment(segment.PresentationCompositionSegment{
+		Width:             e.videoWidth,
+		Height:            e.videoHeight,
+		FrameRate:         frameRate,
+		CompositionNumber: (compositionNumber + 1) % 65536,
+		CompositionState:  segment.CompositionStateNormal,
+		Segment:           segment.Segment{Header: endHeader},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = e.writeWindow(supWriter, endHeader, window)
+
+	if err != nil {
+		return err
+	}
+
+	return supWriter.WriteEndSegment(segment.Segment{Header: endHeader})
+}
+
+func (e *supEncoder) writeWindow(supWriter SupWriter, header segment.SegmentHeader, window segment.WindowDefinition) error {
+	return supWriter.WriteWdsSegment(segment.WindowDefinitionSegment{
+		WindowCount:       1,
+		WindowDefinitions: []segment.WindowDefinition{window},
+		Segment:           segment.Segment{Header: header},
+	})
+}
+
+// header Segment header for a segment presented at the given time, timestamps being in 90kHz units
+func (e *supEncoder) header(presentationTime time.Duration) segment.SegmentHeader {
+	return segment.SegmentHeader{
+		PresentationTimestamp: int(presentationTime.Nanoseconds() * 9 / 100000),
+		DecodingTimestamp:     0,
+		StartTime:             presentationTime,
+	}
+}
@@ -0,0 +1,285 @@
+package pgs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func testSubtitle(x int, y int, width int, height int) Subtitle {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+
+	return Subtitle{
+		Image:     img,
+		StartTime: time.Second,
+		EndTime:   2 * time.Second,
+		X:         x,
+		Y:         y,
+	}
+}
+
+func TestEncodeSubtitleOutsideVideoFrame(t *testing.T) {
+	testCases := []struct {
+		name     string
+		subtitle Subtitle
+		fits     bool
+	}{
+		{name: "inside", subtitle: testSubtitle(10, 20, 100, 50), fits: true},
+		{name: "bottom right corner", subtitle: testSubtitle(1820, 1030, 100, 50), fits: true},
+		{name: "too wide", subtitle: testSubtitle(1821, 20, 100, 50), fits: false},
+		{name: "too high", subtitle: testSubtitle(10, 1031, 100, 50), fits: false},
+		{name: "negative x", subtitle: testSubtitle(-1, 20, 100, 50), fits: false},
+		{name: "negative y", subtitle: testSubtitle(10, -1, 100, 50), fits: false},
+	}
+
+	for _, testCase := range testCases {
+		var sup bytes.Buffer
+
+		err := NewSupEncoder(1920, 1080, displaySet.ColorConversion{}).Encode(&sup, []Subtitle{testCase.subtitle})
+
+		if testCase.fits && err != nil {
+			t.Fatalf("%s: %v", testCase.name, err)
+		}
+
+		if !testCase.fits && err == nil {
+			t.Fatalf("%s: expected an error", testCase.name)
+		}
+	}
+}
+
+func TestEncodeFrameRate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		options   []SupEncoderOption
+		frameRate int
+	}{
+		{name: "default", frameRate: segment.FrameRate23976},
+		{name: "25", options: []SupEncoderOption{WithEncoderFrameRate(25)}, frameRate: segment.FrameRate25},
+		{name: "29.97", options: []SupEncoderOption{WithEncoderFrameRate(30000.0 / 1001)}, frameRate: segment.FrameRate2997},
+		{name: "59.94", options: []SupEncoderOption{WithEncoderFrameRate(59.94)}, frameRate: segment.FrameRate5994},
+	}
+
+	for _, testCase := range testCases {
+		var sup bytes.Buffer
+
+		err := NewSupEncoder(1920, 1080, displaySet.ColorConversion{}, testCase.options...).Encode(&sup, []Subtitle{testSubtitle(10, 20, 100, 50)})
+
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.name, err)
+		}
+
+		displaySets := 0
+
+		err = NewPgsParser().ParseDisplaySetsFromReader(&sup, func(data displaySet.DisplaySet, startTime time.Duration) error {
+			displaySets++
+
+			if frameRate := data.PresentationCompositionSegment().FrameRate; frameRate != testCase.frameRate {
+				t.Fatalf("%s: expected frame rate %x, got %x", testCase.name, testCase.frameRate, frameRate)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.name, err)
+		}
+
+		if displaySets != 2 {
+			t.Fatalf("%s: expected 2 display sets, got %d", testCase.name, displaySets)
+		}
+	}
+}
+
+func TestEncodeUnknownFrameRate(t *testing.T) {
+	var sup bytes.Buffer
+
+	err := NewSupEncoder(1920, 1080, displaySet.ColorConversion{}, WithEncoderFrameRate(30)).Encode(&sup, []Subtitle{testSubtitle(10, 20, 100, 50)})
+
+	if !errors.Is(err, segment.ErrInvalidFrameRate) {
+		t.Fatalf("expected %v, got %v", segment.ErrInvalidFrameRate, err)
+	}
+}
+
+// roundTripImage Encode the image as a subtitle at 100,900 then parse it back with the given options
+func roundTripImage(t *testing.T, img image.Image, conversion displaySet.ColorConversion, options ...Option) displaySet.ImageData {
+	t.Helper()
+
+	var sup bytes.Buffer
+
+	err := NewSupEncoder(1920, 1080, conversion).Encode(&sup, []Subtitle{
+		{Image: img, StartTime: time.Second, EndTime: 2 * time.Second, X: 100, Y: 900},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var images []displaySet.ImageData
+
+	err = NewPgsParser(options...).ParsePgsFromReader(bytes.NewReader(sup.Bytes()), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		images = append(images, data)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 1 {
+		t.Fatalf("expected 1 image, got %d", len(images))
+	}
+
+	bounds := img.Bounds()
+
+	if images[0].X != 100 || images[0].Y != 900 || images[0].Width != bounds.Dx() || images[0].Height != bounds.Dy() {
+		t.Fatalf("expected an image of %dx%d at 100,900, got %dx%d at %d,%d",
+			bounds.Dx(), bounds.Dy(), images[0].Width, images[0].Height, images[0].X, images[0].Y)
+	}
+
+	if images[0].StartTime != time.Second || images[0].EndTime != 2*time.Second {
+		t.Fatalf("expected an image from 1s to 2s, got %v to %v", images[0].StartTime, images[0].EndTime)
+	}
+
+	return images[0]
+}
+
+// colorDistance Largest difference between the components of the colors
+func colorDistance(a color.NRGBA, b color.NRGBA) int {
+	distance := 0
+
+	for _, difference := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A)} {
+		if difference < 0 {
+			difference = -difference
+		}
+
+		if difference > distance {
+			distance = difference
+		}
+	}
+
+	return distance
+}
+
+func TestEncodeRoundTripWithExactPalette(t *testing.T) {
+	// 200 colors, half of them translucent, around a transparent hole
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x >= 15 && x < 25 && y >= 5 && y < 15 {
+				continue
+			}
+
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x % 10 * 25), G: uint8(y % 10 * 25), B: 128, A: uint8(255 - y/10*127)})
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		conversion  displaySet.ColorConversion
+		maxDistance int
+	}{
+		{"BT.709 full range", displaySet.ColorConversion{Matrix: displaySet.ColorMatrixBt709, Range: displaySet.ColorRangeFull}, 2},
+		{"BT.709 limited range", displaySet.ColorConversion{Matrix: displaySet.ColorMatrixBt709, Range: displaySet.ColorRangeLimited}, 3},
+		{"BT.601 limited range", displaySet.ColorConversion{Matrix: displaySet.ColorMatrixBt601, Range: displaySet.ColorRangeLimited}, 3},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rendered := roundTripImage(t, img, testCase.conversion, WithColorConversion(testCase.conversion.Matrix, testCase.conversion.Range))
+			indexed := roundTripImage(t, img, testCase.conversion, WithPalettedImages())
+			paletted := indexed.Image.(*image.Paletted)
+			// Palette entry id of each source color, which must be distinct
+			entries := map[color.NRGBA]uint8{}
+			colors := map[uint8]color.NRGBA{}
+
+			for y := 0; y < 20; y++ {
+				for x := 0; x < 40; x++ {
+					expected := img.NRGBAAt(x, y)
+
+					if got := rendered.Image.(*image.NRGBA).NRGBAAt(x, y); colorDistance(expected, got) > testCase.maxDistance {
+						t.Fatalf("expected %v at %d,%d, got %v", expected, x, y, got)
+					}
+
+					index := paletted.ColorIndexAt(x, y)
+
+					if expected.A == 0 {
+						if index != 0 {
+							t.Fatalf("expected the transparent palette entry at %d,%d, got %d", x, y, index)
+						}
+
+						continue
+					}
+
+					if entry, ok := entries[expected]; ok && entry != index {
+						t.Fatalf("expected %v to use palette entry %d at %d,%d, got %d", expected, entry, x, y, index)
+					}
+
+					if other, ok := colors[index]; ok && other != expected {
+						t.Fatalf("expected %v and %v to use distinct palette entries, got %d for both", other, expected, index)
+					}
+
+					entries[expected] = index
+					colors[index] = expected
+				}
+			}
+
+			if len(entries) != 200 {
+				t.Fatalf("expected 200 palette entries, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTripWithQuantizedPalette(t *testing.T) {
+	// 4096 opaque colors
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+
+	conversion := displaySet.ColorConversion{Matrix: displaySet.ColorMatrixBt709, Range: displaySet.ColorRangeFull}
+	rendered := roundTripImage(t, img, conversion, WithColorConversion(conversion.Matrix, conversion.Range))
+	totalDistance := 0
+	maxDistance := 0
+
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			distance := colorDistance(img.NRGBAAt(x, y), rendered.Image.(*image.NRGBA).NRGBAAt(x, y))
+			totalDistance += distance
+
+			if distance > maxDistance {
+				maxDistance = distance
+			}
+		}
+	}
+
+	// Median cut keeps colors close to the original ones
+	if meanDistance := float64(totalDistance) / 4096; meanDistance > 8 || maxDistance > 24 {
+		t.Fatalf("expected colors close to the original ones, got a mean distance of %.1f and a max distance of %d", meanDistance, maxDistance)
+	}
+
+	indexed := roundTripImage(t, img, conversion, WithPalettedImages())
+	entries := map[uint8]bool{}
+
+	for _, index := range indexed.Image.(*image.Paletted).Pix {
+		entries[index] = true
+	}
+
+	if entries[0] || len(entries) < 128 || len(entries) > displaySet.MaxPaletteColors {
+		t.Fatalf("expected up to %d opaque palette entries to be used, got %d", displaySet.MaxPaletteColors, len(entries))
+	}
+}
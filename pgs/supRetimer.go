@@ -0,0 +1,211 @@
+package pgs
+
+import (
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// maxTimestamp SUP timestamps are 32 bits long
+const maxTimestamp = 1<<32 - 1
+
+// Retiming Changes applied to the timestamps of a SUP stream
+type Retiming struct {
+	// Ratio Every timestamp is multiplied by the ratio before being offset, 0 keeping them unchanged
+	Ratio float64
+
+	// Offset Duration added to every timestamp, timestamps moved before the start of the stream being clamped to 0
+	Offset time.Duration
+
+	// FrameRate PCS frame rate byte written, e.g. segment.FrameRate25, 0 keeping the original one
+	FrameRate int
+}
+
+// NewFrameRateConversion Retiming a stream synchronized with a video at the from frame rate to the same video played
+// at the to frame rate, e.g. from segment.FrameRate23976 to segment.FrameRate25 for a PAL speedup
+func NewFrameRateConversion(from int, to int) (*Retiming, error) {
+	mapper := segment.NewSegmentMapper()
+
+	fromFrameRate, err := mapper.ToFrameRate(byte(from))
+
+	if err != nil {
+		return nil, err
+	}
+
+	toFrameRate, err := mapper.ToFrameRate(byte(to))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Retiming{
+		Ratio:     fromFrameRate / toFrameRate,
+		FrameRate: to,
+	}, nil
+}
+
+type SupRetimer interface {
+	// Retime Write the SUP file at the input file path with its timestamps changed to the output file path
+	Retime(inputFilePath string, outputFilePath string) error
+
+	// RetimeFromReader Write the SUP stream read from reader with its timestamps changed to writer
+	RetimeFromReader(reader io.Reader, writer io.Writer) error
+}
+
+type supRetimer struct {
+	parser   PgsParser
+	retiming Retiming
+}
+
+// NewSupRetimer Initialize a new retimer, offsetting and scaling every PTS and DTS. A DTS of 0 is considered unset and kept
+func NewSupRetimer(retiming Retiming) SupRetimer {
+	return &supRetimer{
+		parser:   NewPgsParser(),
+		retiming: retiming,
+	}
+}
+
+func (s *supRetimer) Retime(inputFilePath string, outputFilePath string) error {
+	input, err := os.Open(inputFilePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	output, err := os.Create(outputFilePath)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.RetimeFromReader(input, output)
+
+	if err != nil {
+		output.Close()
+		return err
+	}
+
+	return output.Close()
+}
+
+func (s *supRetimer) RetimeFromReader(reader io.Reader, writer io.Writer) error {
+	supWriter := NewSupWriter(writer)
+
+	return s.parser.ParseDisplaySetsFromReader(reader, func(data displaySet.DisplaySet, startTime time.Duration) error {
+		retimed, err := s.retimeDisplaySet(data)
+
+		if err != nil {
+			return err
+		}
+
+		return supWriter.WriteDisplaySet(retimed)
+	})
+}
+
+func (s *supRetimer) retimeDisplaySet(data displaySet.DisplaySet) (displaySet.DisplaySet, error) {
+	var err error
+
+	pcs := data.PresentationCompositionSegment()
+	pcs.Header, err = s.retimeHeader(pcs.Header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s.retiming.FrameRate != 0 {
+		pcs.FrameRate = s.retiming.FrameRate
+	}
+
+	var windowDefinitionSegments []segment.WindowDefinitionSegment
+
+	for _, wds := range data.WindowDefinitionSegments() {
+		wds.Header, err = s.retimeHeader(wds.Header)
+
+		if err != nil {
+			return nil, err
+		}
+
+		windowDefinitionSegments = append(windowDefinitionSegments, wds)
+	}
+
+	var paletteDefinitionSegments []segment.PaletteDefinitionSegment
+
+	for _, pds := range data.PaletteDefinitionSegments() {
+		pds.Header, err = s.retimeHeader(pds.Header)
+
+		if err != nil {
+			return nil, err
+		}
+
+		paletteDefinitionSegments = append(paletteDefinitionSegments, pds)
+	}
+
+	var objectDefinitionSegments []segment.ObjectDefinitionSegment
+
+	for _, ods := range data.ObjectDefinitionSegments() {
+		ods.Header, err = s.retimeHeader(ods.Header)
+
+		if err != nil {
+			return nil, err
+		}
+
+		objectDefinitionSegments = append(objectDefinitionSegments, ods)
+	}
+
+	end := data.EndDefinitionSegment()
+	end.Header, err = s.retimeHeader(end.Header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return displaySet.NewDisplaySet(pcs, windowDefinitionSegments, paletteDefinitionSegments, objectDefinitionSegments, end), nil
+}
+
+func (s *supRetimer) retimeHeader(header segment.SegmentHeader) (segment.SegmentHeader, error) {
+	presentationTimestamp, err := s.retimeTimestamp(header.PresentationTimestamp)
+
+	if err != nil {
+		return header, err
+	}
+
+	header.PresentationTimestamp = presentationTimestamp
+	header.StartTime = time.Duration(presentationTimestamp/90) * time.Millisecond
+
+	if header.DecodingTimestamp != 0 {
+		header.DecodingTimestamp, err = s.retimeTimestamp(header.DecodingTimestamp)
+
+		if err != nil {
+			return header, err
+		}
+	}
+
+	return header, nil
+}
+
+// retimeTimestamp Scale and offset a timestamp in 90kHz units
+func (s *supRetimer) retimeTimestamp(timestamp int) (int, error) {
+	scaled := float64(timestamp)
+
+	if s.retiming.Ratio != 0 {
+		scaled *= s.retiming.Ratio
+	}
+
+	retimed := int(math.Round(scaled)) + int(s.retiming.Offset.Nanoseconds()*9/100000)
+
+	if retimed < 0 {
+		return 0, nil
+	}
+
+	if retimed > maxTimestamp {
+		return 0, fmt.Errorf("timestamp %d is out of range once retimed: %d", timestamp, retimed)
+	}
+
+	return retimed, nil
+}
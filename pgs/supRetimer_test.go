@@ -0,0 +1,181 @@
+package pgs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"math"
+	"testing"
+	"time"
+)
+
+// testRetimedSegment Timestamps and PCS frame rate byte of a written segment
+type testRetimedSegment struct {
+	segmentType           byte
+	presentationTimestamp int
+	decodingTimestamp     int
+	frameRate             byte
+}
+
+// withDecodingTimestamps Copy of the stream with the DTS of every segment set to its PTS minus delay, in 90kHz units
+func withDecodingTimestamps(data []byte, delay int) []byte {
+	data = append([]byte(nil), data...)
+
+	for i := 0; i+segmentHeaderLength <= len(data); i += segmentHeaderLength + int(binary.BigEndian.Uint16(data[i+11:])) {
+		binary.BigEndian.PutUint32(data[i+6:], binary.BigEndian.Uint32(data[i+2:])-uint32(delay))
+	}
+
+	return data
+}
+
+func retimeSegments(t *testing.T, retiming Retiming, data []byte) []testRetimedSegment {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	err := NewSupRetimer(retiming).RetimeFromReader(bytes.NewReader(data), &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var segments []testRetimedSegment
+	written := out.Bytes()
+
+	for i := 0; i+segmentHeaderLength <= len(written); i += segmentHeaderLength + int(binary.BigEndian.Uint16(written[i+11:])) {
+		retimed := testRetimedSegment{
+			segmentType:           written[i+10],
+			presentationTimestamp: int(binary.BigEndian.Uint32(written[i+2:])),
+			decodingTimestamp:     int(binary.BigEndian.Uint32(written[i+6:])),
+		}
+
+		if retimed.segmentType == testPcs {
+			retimed.frameRate = written[i+segmentHeaderLength+4]
+		}
+
+		segments = append(segments, retimed)
+	}
+
+	return segments
+}
+
+func TestRetimeTimestamps(t *testing.T) {
+	const second = 90000
+	const delay = second / 2
+
+	conversion, err := NewFrameRateConversion(segment.FrameRate23976, segment.FrameRate25)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scaled := func(timestamp int) int {
+		return int(math.Round(float64(timestamp) * conversion.Ratio))
+	}
+
+	testCases := []struct {
+		name                   string
+		retiming               Retiming
+		presentationTimestamps []int
+		decodingTimestamps     []int
+		frameRate              byte
+	}{
+		{
+			name:                   "unchanged",
+			retiming:               Retiming{},
+			presentationTimestamps: []int{10 * second, 12 * second},
+			decodingTimestamps:     []int{10*second - delay, 12*second - delay},
+			frameRate:              segment.FrameRate23976,
+		},
+		{
+			name:                   "positive offset",
+			retiming:               Retiming{Offset: 2 * time.Second},
+			presentationTimestamps: []int{12 * second, 14 * second},
+			decodingTimestamps:     []int{12*second - delay, 14*second - delay},
+			frameRate:              segment.FrameRate23976,
+		},
+		{
+			name:                   "negative offset clamped to 0",
+			retiming:               Retiming{Offset: -11 * time.Second},
+			presentationTimestamps: []int{0, second},
+			decodingTimestamps:     []int{0, second - delay},
+			frameRate:              segment.FrameRate23976,
+		},
+		{
+			name:                   "speed ratio",
+			retiming:               Retiming{Ratio: 2},
+			presentationTimestamps: []int{20 * second, 24 * second},
+			decodingTimestamps:     []int{20*second - 2*delay, 24*second - 2*delay},
+			frameRate:              segment.FrameRate23976,
+		},
+		{
+			name:                   "ratio applied before offset",
+			retiming:               Retiming{Ratio: 2, Offset: -time.Second},
+			presentationTimestamps: []int{19 * second, 23 * second},
+			decodingTimestamps:     []int{19*second - 2*delay, 23*second - 2*delay},
+			frameRate:              segment.FrameRate23976,
+		},
+		{
+			name:                   "frame rate conversion",
+			retiming:               *conversion,
+			presentationTimestamps: []int{scaled(10 * second), scaled(12 * second)},
+			decodingTimestamps:     []int{scaled(10*second - delay), scaled(12*second - delay)},
+			frameRate:              segment.FrameRate25,
+		},
+	}
+
+	var data []byte
+
+	data = append(data, testEpochStart(10, 0)...)
+	data = append(data, testNormal(12, 1, false)...)
+	data = withDecodingTimestamps(data, delay)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			segments := retimeSegments(t, testCase.retiming, data)
+
+			// Epoch start of 5 segments, then PCS and END
+			if len(segments) != 7 {
+				t.Fatalf("expected 7 segments, got %d", len(segments))
+			}
+
+			for i, retimed := range segments {
+				displaySetIndex := 0
+
+				if i >= 5 {
+					displaySetIndex = 1
+				}
+
+				if expected := testCase.presentationTimestamps[displaySetIndex]; retimed.presentationTimestamp != expected {
+					t.Errorf("segment %d: expected PTS %d, got %d", i, expected, retimed.presentationTimestamp)
+				}
+
+				if expected := testCase.decodingTimestamps[displaySetIndex]; retimed.decodingTimestamp != expected {
+					t.Errorf("segment %d: expected DTS %d, got %d", i, expected, retimed.decodingTimestamp)
+				}
+
+				if retimed.segmentType == testPcs && retimed.frameRate != testCase.frameRate {
+					t.Errorf("segment %d: expected frame rate byte %x, got %x", i, testCase.frameRate, retimed.frameRate)
+				}
+			}
+		})
+	}
+}
+
+func TestRetimeKeepsUnsetDecodingTimestamp(t *testing.T) {
+	segments := retimeSegments(t, Retiming{Offset: time.Second}, testEpochStart(10, 0))
+
+	for i, retimed := range segments {
+		if retimed.decodingTimestamp != 0 {
+			t.Errorf("segment %d: expected DTS to stay unset, got %d", i, retimed.decodingTimestamp)
+		}
+	}
+}
+
+func TestRetimeTimestampOutOfRange(t *testing.T) {
+	err := NewSupRetimer(Retiming{Ratio: 1000}).RetimeFromReader(bytes.NewReader(testEpochStart(10*3600, 0)), &bytes.Buffer{})
+
+	if err == nil {
+		t.Fatal("expected an error for a timestamp overflowing 32 bits")
+	}
+}
@@ -0,0 +1,263 @@
+package pgs
+
+import (
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"io"
+)
+
+const maxSegmentSize = 65535
+
+// odsFirstFragmentHeaderLength Object id, version, sequence flag, object data length, width and height
+const odsFirstFragmentHeaderLength = 11
+
+// odsFragmentHeaderLength Object id, version and sequence flag
+const odsFragmentHeaderLength = 4
+
+type SupWriter interface {
+	// WriteDisplaySet Write the PCS, WDS, PDS, ODS and END segments of the display set
+	WriteDisplaySet(data displaySet.DisplaySet) error
+
+	WritePcsSegment(pcs segment.PresentationCompositionSegment) error
+
+	WriteWdsSegment(wds segment.WindowDefinitionSegment) error
+
+	WritePdsSegment(pds segment.PaletteDefinitionSegment) error
+
+	WriteOdsSegment(ods segment.ObjectDefinitionSegment) error
+
+	// WriteObject Write the RLE encoded object data, split across as many ODS as needed
+	WriteObject(header segment.SegmentHeader, objectId int, objectVersionNumber int, width int, height int, objectData []byte) error
+
+	WriteEndSegment(end segment.Segment) error
+}
+
+type supWriter struct {
+	writer        io.Writer
+	segmentMapper segment.SegmentMapper
+}
+
+// NewSupWriter Initialize a new writer of PGS segments in the SUP format
+func NewSupWriter(writer io.Writer) SupWriter {
+	return &supWriter{
+		writer:        writer,
+		segmentMapper: segment.NewSegmentMapper(),
+	}
+}
+
+func (s *supWriter) WriteDisplaySet(data displaySet.DisplaySet) error {
+	err := s.WritePcsSegment(data.PresentationCompositionSegment())
+
+	if err != nil {
+		return err
+	}
+
+	for _, wds := range data.WindowDefinitionSegments() {
+		err = s.WriteWdsSegment(wds)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pds := range data.PaletteDefinitionSegments() {
+		err = s.WritePdsSegment(pds)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ods := range data.ObjectDefinitionSegments() {
+		err = s.WriteOdsSegment(ods)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.WriteEndSegment(data.EndDefinitionSegment())
+}
+
+func (s *supWriter) WritePcsSegment(pcs segment.PresentationCompositionSegment) error {
+	payload := buffer.NewBufferWriter()
+
+	payload.WriteBytes(pcs.Width, 2)
+	payload.WriteBytes(pcs.Height, 2)
+	payload.WriteBytes(pcs.FrameRate, 1)
+	payload.WriteBytes(pcs.CompositionNumber, 2)
+	payload.WriteBytes(int(s.segmentMapper.FromCompositionState(pcs.CompositionState)), 1)
+	payload.WriteBytes(int(s.segmentMapper.FromPaletteUpdateFlag(pcs.PaletteUpdateFlag)), 1)
+	payload.WriteBytes(pcs.PaletteId, 1)
+	payload.WriteBytes(len(pcs.CompositionObjects), 1)
+
+	for _, compositionObject := range pcs.CompositionObjects {
+		payload.WriteBytes(compositionObject.ObjectId, 2)
+		payload.WriteBytes(compositionObject.WindowId, 1)
+		payload.WriteBytes(int(s.segmentMapper.FromObjectFlags(compositionObject.ObjectCroppedFlag, compositionObject.ObjectForcedOnFlag)), 1)
+		payload.WriteBytes(compositionObject.ObjectHorizontalPosition, 2)
+		payload.WriteBytes(compositionObject.ObjectVerticalPosition, 2)
+
+		if compositionObject.ObjectCroppedFlag {
+			payload.WriteBytes(compositionObject.ObjectCroppingHorizontalPosition, 2)
+			payload.WriteBytes(compositionObject.ObjectCroppingVerticalPosition, 2)
+			payload.WriteBytes(compositionObject.ObjectCroppingWidth, 2)
+			payload.WriteBytes(compositionObject.ObjectCroppingHeight, 2)
+		}
+	}
+
+	return s.writeSegment(pcs.Header, segment.SegmentTypePcs, payload)
+}
+
+func (s *supWriter) WriteWdsSegment(wds segment.WindowDefinitionSegment) error {
+	payload := buffer.NewBufferWriter()
+
+	payload.WriteBytes(len(wds.WindowDefinitions), 1)
+
+	for _, window := range wds.WindowDefinitions {
+		payload.WriteBytes(window.WindowId, 1)
+		payload.WriteBytes(window.WindowHorizontalPosition, 2)
+		payload.WriteBytes(window.WindowVerticalPosition, 2)
+		payload.WriteBytes(window.WindowWidth, 2)
+		payload.WriteBytes(window.WindowHeight, 2)
+	}
+
+	return s.writeSegment(wds.Header, segment.SegmentTypeWds, payload)
+}
+
+func (s *supWriter) WritePdsSegment(pds segment.PaletteDefinitionSegment) error {
+	payload := buffer.NewBufferWriter()
+
+	payload.WriteBytes(pds.PaletteId, 1)
+	payload.WriteBytes(pds.PaletteVersionNumber, 1)
+
+	for _, entry := range pds.PaletteEntries {
+		payload.WriteBytes(entry.PaletteEntryId, 1)
+		payload.WriteBytes(entry.Luminance, 1)
+		payload.WriteBytes(entry.ColorDifferenceRed, 1)
+		payload.WriteBytes(entry.ColorDifferenceBlue, 1)
+		payload.WriteBytes(entry.Transparency, 1)
+	}
+
+	return s.writeSegment(pds.Header, segment.SegmentTypePds, payload)
+}
+
+func (s *supWriter) WriteOdsSegment(ods segment.ObjectDefinitionSegment) error {
+	payload := buffer.NewBufferWriter()
+
+	payload.WriteBytes(ods.ObjectId, 2)
+	payload.WriteBytes(ods.ObjectVersionNumber, 1)
+	payload.WriteBytes(int(s.segmentMapper.FromLastInSequenceFlag(ods.LastInSequenceFlag)), 1)
+
+	if ods.LastInSequenceFlag == segment.LastInSequenceFlagFirstInSequence || ods.LastInSequenceFlag == segment.LastInSequenceFlagFirstAndLastInSequence {
+		if ods.Width == nil || ods.Height == nil {
+			return fmt.Errorf("first ODS of object %d must define width and height", ods.ObjectId)
+		}
+
+		payload.WriteBytes(ods.ObjectDataLength, 3)
+		payload.WriteBytes(*ods.Width, 2)
+		payload.WriteBytes(*ods.Height, 2)
+	}
+
+	if ods.ObjectData != nil {
+		err := payload.WriteBuffer(ods.ObjectData)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.writeSegment(ods.Header, segment.SegmentTypeOds, payload)
+}
+
+func (s *supWriter) WriteObject(header segment.SegmentHeader, objectId int, objectVersionNumber int, width int, height int, objectData []byte) error {
+	// Object data length includes width and height
+	objectDataLength := len(objectData) + 4
+	remaining := objectData
+	first := true
+
+	for first || len(remaining) > 0 {
+		capacity := maxSegmentSize - odsFragmentHeaderLength
+
+		if first {
+			capacity = maxSegmentSize - odsFirstFragmentHeaderLength
+		}
+
+		fragmentLength := len(remaining)
+
+		if fragmentLength > capacity {
+			fragmentLength = capacity
+		}
+
+		last := fragmentLength == len(remaining)
+
+		ods := segment.ObjectDefinitionSegment{
+			ObjectId:            objectId,
+			ObjectVersionNumber: objectVersionNumber,
+			LastInSequenceFlag:  s.lastInSequenceFlag(first, last),
+			ObjectData:          buffer.NewUint8ArrayBuffer(remaining[:fragmentLength]),
+			Segment: segment.Segment{
+				Header: header,
+			},
+		}
+
+		if first {
+			ods.ObjectDataLength = objectDataLength
+			ods.Width = &width
+			ods.Height = &height
+		}
+
+		err := s.WriteOdsSegment(ods)
+
+		if err != nil {
+			return err
+		}
+
+		remaining = remaining[fragmentLength:]
+		first = false
+	}
+
+	return nil
+}
+
+func (s *supWriter) WriteEndSegment(end segment.Segment) error {
+	return s.writeSegment(end.Header, segment.SegmentTypeEnd, buffer.NewBufferWriter())
+}
+
+func (s *supWriter) lastInSequenceFlag(first bool, last bool) segment.LastInSequenceFlag {
+	if first && last {
+		return segment.LastInSequenceFlagFirstAndLastInSequence
+	} else if first {
+		return segment.LastInSequenceFlagFirstInSequence
+	} else if last {
+		return segment.LastInSequenceFlagLastInSequence
+	}
+
+	return segment.LastInSequenceFlagMiddleOfSequence
+}
+
+func (s *supWriter) writeSegment(header segment.SegmentHeader, segmentType segment.SegmentType, payload buffer.BufferWriter) error {
+	if payload.Length() > maxSegmentSize {
+		return fmt.Errorf("%s segment is too large: %d bytes", segmentType, payload.Length())
+	}
+
+	headerWriter := buffer.NewBufferWriter()
+
+	headerWriter.WriteBytes(segment.PgMagicNumber, 2)
+	headerWriter.WriteBytes(header.PresentationTimestamp, 4)
+	headerWriter.WriteBytes(header.DecodingTimestamp, 4)
+	headerWriter.WriteBytes(int(s.segmentMapper.FromSegmentType(segmentType)), 1)
+	headerWriter.WriteBytes(payload.Length(), 2)
+
+	_, err := s.writer.Write(headerWriter.Bytes())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.writer.Write(payload.Bytes())
+
+	return err
+}
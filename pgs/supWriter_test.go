@@ -0,0 +1,117 @@
+package pgs
+
+import (
+	"bytes"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"image"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rewrite Parse the stream and write its display sets back
+func rewrite(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var written bytes.Buffer
+	writer := NewSupWriter(&written)
+
+	err := NewPgsParser().ParseDisplaySetsFromReader(bytes.NewReader(data), func(data displaySet.DisplaySet, startTime time.Duration) error {
+		return writer.WriteDisplaySet(data)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return written.Bytes()
+}
+
+func TestWriteParsedDisplaySets(t *testing.T) {
+	var data []byte
+
+	data = append(data, testEpochStart(1, 0)...)
+	data = append(data, testAcquisitionPoint(2, 1, 1, 2)...)
+
+	// Palette update of the object on screen
+	paletteUpdate := testPcsPayload(2, 0, true)
+	paletteUpdate[8] = 0x80
+	data = append(data, testSegment(3, testPcs, paletteUpdate)...)
+	data = append(data, testSegment(3, testPds, []byte{0, 1, 1, 128, 128, 128, 128, 2, 16, 128, 128, 128})...)
+	data = append(data, testSegment(3, testEnd, nil)...)
+
+	// Cropped and forced object
+	cropped := testPcsPayload(3, 0, false)
+	cropped[10] = 1
+	cropped = append(cropped, 0, 0, 0, 0xC0, 0x03, 0x00, 0x03, 0x84, 0, 2, 0, 1, 0, 10, 0, 5)
+	data = append(data, testSegment(4, testPcs, cropped)...)
+	data = append(data, testSegment(4, testEnd, nil)...)
+
+	data = append(data, testNormal(5, 4, false)...)
+
+	if written := rewrite(t, data); !bytes.Equal(written, data) {
+		t.Fatalf("expected the written stream to be identical to the parsed one:\n%x\ngot:\n%x", data, written)
+	}
+}
+
+func TestWriteParsedLargeObject(t *testing.T) {
+	// Random pixels, so that the object is split across several ODS
+	random := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, 1920, 300))
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = uint8(random.Intn(16) * 16)
+		img.Pix[i+1] = uint8(random.Intn(4) * 64)
+		img.Pix[i+2] = uint8(random.Intn(4) * 64)
+		img.Pix[i+3] = 255
+	}
+
+	var data bytes.Buffer
+
+	err := NewSupEncoder(1920, 1080, displaySet.ColorConversion{}).Encode(&data, []Subtitle{
+		{Image: img, StartTime: time.Second, EndTime: 2 * time.Second},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objectDefinitions := 0
+
+	err = NewPgsParser().ParseDisplaySetsFromReader(bytes.NewReader(data.Bytes()), func(data displaySet.DisplaySet, startTime time.Duration) error {
+		objectDefinitions += len(data.ObjectDefinitionSegments())
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if objectDefinitions < 2 {
+		t.Fatalf("expected the object to be split across several ODS, got %d", objectDefinitions)
+	}
+
+	if written := rewrite(t, data.Bytes()); !bytes.Equal(written, data.Bytes()) {
+		t.Fatalf("expected the written stream of %d bytes to be identical to the parsed one of %d bytes", len(written), data.Len())
+	}
+}
+
+func TestWriteTooLargeSegment(t *testing.T) {
+	width := 1
+	height := 1
+
+	err := NewSupWriter(&bytes.Buffer{}).WriteOdsSegment(segment.ObjectDefinitionSegment{
+		LastInSequenceFlag: segment.LastInSequenceFlagFirstAndLastInSequence,
+		Width:              &width,
+		Height:             &height,
+		ObjectData:         buffer.NewUint8ArrayBuffer(make([]byte, maxSegmentSize)),
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "ODS segment") {
+		t.Fatalf("expected an error naming the ODS segment, got %v", err)
+	}
+}
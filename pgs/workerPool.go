@@ -0,0 +1,264 @@
+package pgs
+
+import (
+	"context"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"io"
+	"sync"
+	"time"
+)
+
+// imageTask Part of the handling of an image which may run on a worker, called even once ctx is done so that it can
+// release what the ordered part acquired
+type imageTask func(ctx context.Context) error
+
+// imageHandler Called in index order with each image, returning the task to run on a worker if any
+type imageHandler func(index int, startTime time.Duration, data displaySet.ImageData) (imageTask, error)
+
+// renderedDisplaySet A display set and its image, sequence being its position in the stream
+type renderedDisplaySet struct {
+	sequence  int
+	set       displaySet.DisplaySet
+	imageData *displaySet.ImageData
+	err       error
+}
+
+// parseImages Render the display sets of the stream, fill the end time of their images and hand them to handle in index order,
+// on p.workers goroutines if set
+func (p *pgsParser) parseImages(ctx context.Context, reader io.Reader, handle imageHandler) error {
+	if p.workers > 1 {
+		return p.parseImagesConcurrently(ctx, reader, handle)
+	}
+
+	i := 0
+	timeline := newImageTimeline()
+
+	emit := func(imageData *displaySet.ImageData) error {
+		if imageData == nil {
+			return nil
+		}
+
+		task, err := handle(i, imageData.StartTime, *imageData)
+
+		if err != nil {
+			return err
+		}
+		i++
+
+		if task != nil {
+			return task(ctx)
+		}
+
+		return nil
+	}
+
+	err := p.ParseDisplaySetsFromReaderContext(ctx, reader, func(data displaySet.DisplaySet, startTime time.Duration) error {
+		imageData, err := data.ToImageDataContext(ctx, p.renderOptions)
+
+		if p.skipRenderError(ctx, err) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return emit(timeline.push(data, imageData))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return emit(timeline.flush())
+}
+
+// parseImagesConcurrently Parse the display sets on one goroutine, render them on p.workers goroutines, put them back in
+// stream order to fill the timeline and run the tasks returned by handle on p.workers other goroutines.
+// The first error cancels the context given to the others
+func (p *pgsParser) parseImagesConcurrently(ctx context.Context, reader io.Reader, handle imageHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if p.lenient {
+		// Warnings come from both the parsing and the rendering goroutines
+		var warningMutex sync.Mutex
+		onWarning := p.onWarning
+		parser := *p
+		parser.onWarning = func(err error) {
+			warningMutex.Lock()
+			defer warningMutex.Unlock()
+
+			onWarning(err)
+		}
+		p = &parser
+	}
+
+	var firstErr error
+	var failOnce sync.Once
+
+	fail := func(err error) {
+		failOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	// window Bounds the display sets parsed ahead of the oldest one not rendered yet
+	window := make(chan struct{}, 2*p.workers)
+	displaySets := make(chan renderedDisplaySet)
+	rendered := make(chan renderedDisplaySet, p.workers)
+	tasks := make(chan imageTask, p.workers)
+
+	var parsing sync.WaitGroup
+	parsing.Add(1)
+
+	go func() {
+		defer parsing.Done()
+		defer close(displaySets)
+
+		iterator := p.IterateDisplaySetsContext(ctx, reader)
+
+		for sequence := 0; ; sequence++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			set, err := iterator.Next()
+
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			select {
+			case displaySets <- renderedDisplaySet{sequence: sequence, set: set}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var renderers sync.WaitGroup
+
+	for w := 0; w < p.workers; w++ {
+		renderers.Add(1)
+
+		go func() {
+			defer renderers.Done()
+
+			for data := range displaySets {
+				data.imageData, data.err = data.set.ToImageDataContext(ctx, p.renderOptions)
+
+				select {
+				case rendered <- data:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		renderers.Wait()
+		close(rendered)
+	}()
+
+	var runners sync.WaitGroup
+
+	for w := 0; w < p.workers; w++ {
+		runners.Add(1)
+
+		go func() {
+			defer runners.Done()
+
+			for task := range tasks {
+				if err := task(ctx); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	i := 0
+	timeline := newImageTimeline()
+
+	emit := func(imageData *displaySet.ImageData) error {
+		if imageData == nil {
+			return nil
+		}
+
+		task, err := handle(i, imageData.StartTime, *imageData)
+
+		if err != nil {
+			return err
+		}
+		i++
+
+		if task != nil {
+			tasks <- task
+		}
+
+		return nil
+	}
+
+	next := 0
+	pending := make(map[int]renderedDisplaySet)
+
+	for data := range rendered {
+		pending[data.sequence] = data
+
+		for ready, ok := pending[next]; ok && ctx.Err() == nil; ready, ok = pending[next] {
+			delete(pending, next)
+			next++
+			<-window
+
+			if p.skipRenderError(ctx, ready.err) {
+				continue
+			}
+
+			err := ready.err
+
+			if err == nil {
+				err = emit(timeline.push(ready.set, ready.imageData))
+			}
+
+			if err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	if ctx.Err() == nil {
+		if err := emit(timeline.flush()); err != nil {
+			fail(err)
+		}
+	}
+
+	close(tasks)
+	runners.Wait()
+	parsing.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+// skipRenderError Whether the error rendering a display set is reported as a warning in lenient mode
+func (p *pgsParser) skipRenderError(ctx context.Context, err error) bool {
+	if err != nil && p.lenient && ctx.Err() == nil {
+		// e.g. the display set references an object of a display set skipped in lenient mode
+		p.onWarning(err)
+		return true
+	}
+
+	return false
+}
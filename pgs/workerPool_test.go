@@ -0,0 +1,194 @@
+package pgs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mbiamont/go-pgs-parser/displaySet"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"testing"
+	"time"
+)
+
+// parsedImage What a callback receives for an image
+type parsedImage struct {
+	index     int
+	startTime time.Duration
+	data      displaySet.ImageData
+}
+
+// encodeDistinctSubtitles SUP stream of count subtitles of different sizes and colors, each one replacing the previous
+// one or shown after a gap
+func encodeDistinctSubtitles(t *testing.T, count int) []byte {
+	t.Helper()
+
+	var subtitles []Subtitle
+	startTime := time.Second
+
+	for i := 0; i < count; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 40+i%17, 20+i%5))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: uint8(i * 37), G: uint8(255 - i*11), B: uint8(i * 5), A: 255}), image.Point{}, draw.Src)
+
+		endTime := startTime + time.Duration(500+i%7*100)*time.Millisecond
+
+		subtitles = append(subtitles, Subtitle{
+			Image:     img,
+			StartTime: startTime,
+			EndTime:   endTime,
+			X:         100 + i,
+			Y:         900,
+		})
+
+		startTime = endTime
+
+		if i%4 == 0 {
+			startTime += time.Second
+		}
+	}
+
+	var sup bytes.Buffer
+
+	err := NewSupEncoder(1920, 1080, displaySet.ColorConversion{}).Encode(&sup, subtitles)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sup.Bytes()
+}
+
+func collectImages(t *testing.T, sup []byte, options ...Option) []parsedImage {
+	t.Helper()
+
+	var images []parsedImage
+
+	err := NewPgsParser(options...).ParsePgsFromReader(bytes.NewReader(sup), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		images = append(images, parsedImage{index: index, startTime: startTime, data: data})
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return images
+}
+
+func TestWorkersMatchSequentialParsing(t *testing.T) {
+	sup := encodeDistinctSubtitles(t, 60)
+	expected := collectImages(t, sup)
+
+	if len(expected) != 60 {
+		t.Fatalf("expected 60 images, got %d", len(expected))
+	}
+
+	for _, workers := range []int{2, 4, 16} {
+		got := collectImages(t, sup, WithWorkers(workers))
+
+		if len(got) != len(expected) {
+			t.Fatalf("%d workers: expected %d images, got %d", workers, len(expected), len(got))
+		}
+
+		for i := range expected {
+			e, g := expected[i], got[i]
+
+			if g.index != e.index || g.startTime != e.startTime || g.data.StartTime != e.data.StartTime || g.data.EndTime != e.data.EndTime {
+				t.Fatalf("%d workers: expected image %d at %s-%s, got image %d at %s-%s", workers,
+					e.index, e.data.StartTime, e.data.EndTime, g.index, g.data.StartTime, g.data.EndTime)
+			}
+
+			if g.data.Image.Bounds() != e.data.Image.Bounds() || g.data.X != e.data.X || g.data.Y != e.data.Y {
+				t.Fatalf("%d workers: image %d has bounds %v at %d,%d instead of %v at %d,%d", workers, i,
+					g.data.Image.Bounds(), g.data.X, g.data.Y, e.data.Image.Bounds(), e.data.X, e.data.Y)
+			}
+
+			if !bytes.Equal(g.data.Image.(*image.RGBA).Pix, e.data.Image.(*image.RGBA).Pix) {
+				t.Fatalf("%d workers: image %d has different pixels", workers, i)
+			}
+		}
+	}
+}
+
+func TestWorkersStopOnCallbackError(t *testing.T) {
+	sup := encodeDistinctSubtitles(t, 60)
+	errStop := errors.New("stop")
+
+	for _, unordered := range []bool{false, true} {
+		options := []Option{WithWorkers(4)}
+
+		if unordered {
+			options = append(options, WithUnorderedCallbacks())
+		}
+
+		var mutex sync.Mutex
+		calls := 0
+
+		err := NewPgsParser(options...).ParsePgsFromReader(bytes.NewReader(sup), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			calls++
+
+			if index == 2 {
+				return errStop
+			}
+
+			return nil
+		})
+
+		if !errors.Is(err, errStop) {
+			t.Fatalf("unordered %v: expected %v, got %v", unordered, errStop, err)
+		}
+
+		if !unordered && calls != 3 {
+			t.Fatalf("expected the callback to be called 3 times, got %d", calls)
+		}
+
+		if calls == 60 {
+			t.Fatalf("unordered %v: expected the parsing to stop before the last image", unordered)
+		}
+	}
+}
+
+func TestUnorderedCallbacksDeliverEveryIndexOnce(t *testing.T) {
+	sup := encodeDistinctSubtitles(t, 60)
+	expected := collectImages(t, sup)
+
+	var mutex sync.Mutex
+	received := make(map[int]int)
+
+	err := NewPgsParser(WithWorkers(4), WithUnorderedCallbacks()).ParsePgsFromReader(bytes.NewReader(sup), func(index int, startTime time.Duration, data displaySet.ImageData) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		received[index]++
+
+		if index < 0 || index >= len(expected) {
+			t.Errorf("unexpected index %d", index)
+			return nil
+		}
+
+		if e := expected[index].data; data.StartTime != e.StartTime || data.EndTime != e.EndTime {
+			t.Errorf("expected image %d at %s-%s, got %s-%s", index, e.StartTime, e.EndTime, data.StartTime, data.EndTime)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range expected {
+		if received[index] != 1 {
+			t.Fatalf("expected index %d to be delivered once, got %d times", index, received[index])
+		}
+	}
+
+	if len(received) != len(expected) {
+		t.Fatalf("expected %d indices, got %d", len(expected), len(received))
+	}
+}
@@ -0,0 +1,14 @@
+package segment
+
+import "errors"
+
+// Errors returned by the SegmentMapper for bytes that don't match any known value
+var (
+	ErrInvalidSegmentType        = errors.New("invalid segment type byte")
+	ErrInvalidCompositionState   = errors.New("invalid composition state byte")
+	ErrInvalidPaletteUpdateFlag  = errors.New("invalid palette update flag byte")
+	ErrInvalidObjectCroppedFlag  = errors.New("invalid object cropped flag byte")
+	ErrInvalidObjectFlags        = errors.New("invalid composition object flags byte")
+	ErrInvalidLastInSequenceFlag = errors.New("invalid last in sequence flag byte")
+	ErrInvalidFrameRate          = errors.New("invalid frame rate byte")
+)
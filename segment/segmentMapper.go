@@ -1,8 +1,8 @@
 package segment
 
 import (
-	"errors"
 	"fmt"
+	"math"
 )
 
 type SegmentMapper interface {
@@ -14,7 +14,25 @@ type SegmentMapper interface {
 
 	ToObjectCroppedFlag(b byte) (bool, error)
 
+	ToObjectFlags(b byte) (objectCroppedFlag bool, objectForcedOnFlag bool, err error)
+
 	ToLastInSequenceFlag(b byte) (LastInSequenceFlag, error)
+
+	ToFrameRate(b byte) (float64, error)
+
+	FromSegmentType(segmentType SegmentType) byte
+
+	FromCompositionState(compositionState CompositionState) byte
+
+	FromPaletteUpdateFlag(paletteUpdateFlag bool) byte
+
+	FromObjectCroppedFlag(objectCroppedFlag bool) byte
+
+	FromObjectFlags(objectCroppedFlag bool, objectForcedOnFlag bool) byte
+
+	FromLastInSequenceFlag(lastInSequenceFlag LastInSequenceFlag) byte
+
+	FromFrameRate(frameRate float64) (byte, error)
 }
 
 func NewSegmentMapper() SegmentMapper {
@@ -38,7 +56,7 @@ func (*segmentMapper) ToSegmentType(b byte) (SegmentType, error) {
 		return SegmentTypeEnd, nil
 	}
 
-	return 0, errors.New(fmt.Sprintf("invalid segment type byte: %x", b))
+	return 0, fmt.Errorf("%w: %x", ErrInvalidSegmentType, b)
 }
 
 func (*segmentMapper) ToCompositionState(b byte) (CompositionState, error) {
@@ -51,7 +69,7 @@ func (*segmentMapper) ToCompositionState(b byte) (CompositionState, error) {
 		return CompositionStateEpochStart, nil
 	}
 
-	return 0, errors.New(fmt.Sprintf("invalid composition state byte: %x", b))
+	return 0, fmt.Errorf("%w: %x", ErrInvalidCompositionState, b)
 }
 
 func (*segmentMapper) ToPaletteUpdateFlag(b byte) (bool, error) {
@@ -62,22 +80,31 @@ func (*segmentMapper) ToPaletteUpdateFlag(b byte) (bool, error) {
 		return true, nil
 	}
 
-	return false, errors.New(fmt.Sprintf("invalid palette update flag byte: %x", b))
+	return false, fmt.Errorf("%w: %x", ErrInvalidPaletteUpdateFlag, b)
 }
 
+// ToObjectCroppedFlag The flags byte of a composition object holds the cropped flag in bit 7 and the forced on flag in bit 6
 func (*segmentMapper) ToObjectCroppedFlag(b byte) (bool, error) {
-	switch b {
-	case 0:
-		return false, nil
-	case 64:
-		return true, nil
+	if b&0x3F != 0 {
+		return false, fmt.Errorf("%w: %x", ErrInvalidObjectCroppedFlag, b)
 	}
 
-	return false, errors.New(fmt.Sprintf("invalid object cropped flag byte: %x", b))
+	return b&0x80 != 0, nil
+}
+
+// ToObjectFlags Decode both flags of the flags byte of a composition object
+func (*segmentMapper) ToObjectFlags(b byte) (bool, bool, error) {
+	if b&0x3F != 0 {
+		return false, false, fmt.Errorf("%w: %x", ErrInvalidObjectFlags, b)
+	}
+
+	return b&0x80 != 0, b&0x40 != 0, nil
 }
 
 func (*segmentMapper) ToLastInSequenceFlag(b byte) (LastInSequenceFlag, error) {
 	switch b {
+	case 0:
+		return LastInSequenceFlagMiddleOfSequence, nil
 	case 64:
 		return LastInSequenceFlagLastInSequence, nil
 	case 128:
@@ -86,5 +113,103 @@ func (*segmentMapper) ToLastInSequenceFlag(b byte) (LastInSequenceFlag, error) {
 		return LastInSequenceFlagFirstAndLastInSequence, nil
 	}
 
-	return 0, errors.New(fmt.Sprintf("invalid object cropped flag byte: %x", b))
+	return 0, fmt.Errorf("%w: %x", ErrInvalidLastInSequenceFlag, b)
+}
+
+func (*segmentMapper) ToFrameRate(b byte) (float64, error) {
+	switch b {
+	case FrameRate23976:
+		return 24000.0 / 1001, nil
+	case FrameRate24:
+		return 24, nil
+	case FrameRate25:
+		return 25, nil
+	case FrameRate2997:
+		return 30000.0 / 1001, nil
+	case FrameRate50:
+		return 50, nil
+	case FrameRate5994:
+		return 60000.0 / 1001, nil
+	}
+
+	return 0, fmt.Errorf("%w: %x", ErrInvalidFrameRate, b)
+}
+
+func (*segmentMapper) FromSegmentType(segmentType SegmentType) byte {
+	switch segmentType {
+	case SegmentTypePds:
+		return 20
+	case SegmentTypeOds:
+		return 21
+	case SegmentTypePcs:
+		return 22
+	case SegmentTypeWds:
+		return 23
+	}
+
+	return 128
+}
+
+func (*segmentMapper) FromCompositionState(compositionState CompositionState) byte {
+	switch compositionState {
+	case CompositionStateAcquisitionState:
+		return 64
+	case CompositionStateEpochStart:
+		return 128
+	}
+
+	return 0
+}
+
+func (*segmentMapper) FromPaletteUpdateFlag(paletteUpdateFlag bool) byte {
+	if paletteUpdateFlag {
+		return 128
+	}
+
+	return 0
+}
+
+func (*segmentMapper) FromObjectCroppedFlag(objectCroppedFlag bool) byte {
+	if objectCroppedFlag {
+		return 128
+	}
+
+	return 0
+}
+
+func (m *segmentMapper) FromObjectFlags(objectCroppedFlag bool, objectForcedOnFlag bool) byte {
+	b := m.FromObjectCroppedFlag(objectCroppedFlag)
+
+	if objectForcedOnFlag {
+		b |= 64
+	}
+
+	return b
+}
+
+func (*segmentMapper) FromLastInSequenceFlag(lastInSequenceFlag LastInSequenceFlag) byte {
+	switch lastInSequenceFlag {
+	case LastInSequenceFlagLastInSequence:
+		return 64
+	case LastInSequenceFlagFirstInSequence:
+		return 128
+	case LastInSequenceFlagFirstAndLastInSequence:
+		return 192
+	}
+
+	return 0
+}
+
+// FromFrameRate Byte of the PGS frame rate within 0.01 of the given one, e.g. 23.976 or 24000/1001 for FrameRate23976.
+// Other frame rates give ErrInvalidFrameRate
+func (m *segmentMapper) FromFrameRate(frameRate float64) (byte, error) {
+	for _, b := range []byte{FrameRate23976, FrameRate24, FrameRate25, FrameRate2997, FrameRate50, FrameRate5994} {
+		value, _ := m.ToFrameRate(b)
+
+		if math.Abs(value-frameRate) < 0.01 {
+			return b, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %v", ErrInvalidFrameRate, frameRate)
 }
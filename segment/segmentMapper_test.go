@@ -0,0 +1,39 @@
+package segment
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestObjectFlags(t *testing.T) {
+	mapper := NewSegmentMapper()
+
+	for _, cropped := range []bool{false, true} {
+		for _, forced := range []bool{false, true} {
+			b := mapper.FromObjectFlags(cropped, forced)
+			gotCropped, gotForced, err := mapper.ToObjectFlags(b)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if gotCropped != cropped || gotForced != forced {
+				t.Fatalf("expected cropped %v and forced %v from %x, got %v and %v", cropped, forced, b, gotCropped, gotForced)
+			}
+		}
+	}
+
+	if b := mapper.FromObjectFlags(true, true); b != 0xC0 {
+		t.Fatalf("expected flags byte c0, got %x", b)
+	}
+
+	for _, b := range []byte{0x01, 0x20, 0x3F, 0xC1} {
+		if _, _, err := mapper.ToObjectFlags(b); !errors.Is(err, ErrInvalidObjectFlags) {
+			t.Fatalf("expected %v for %x, got %v", ErrInvalidObjectFlags, b, err)
+		}
+
+		if _, err := mapper.ToObjectCroppedFlag(b); !errors.Is(err, ErrInvalidObjectCroppedFlag) {
+			t.Fatalf("expected %v for %x, got %v", ErrInvalidObjectCroppedFlag, b, err)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package segment
 
 import (
+	"fmt"
 	"github.com/mbiamont/go-pgs-parser/buffer"
 	"time"
 )
 
+// PgMagicNumber "PG", the first two bytes of every segment header
+const PgMagicNumber = 20551 // 0x5047
+
 type SegmentType uint8
 
 const (
@@ -15,6 +19,24 @@ const (
 	SegmentTypeEnd
 )
 
+// String Abbreviated name of the segment type, e.g. "PCS"
+func (s SegmentType) String() string {
+	switch s {
+	case SegmentTypePds:
+		return "PDS"
+	case SegmentTypeOds:
+		return "ODS"
+	case SegmentTypePcs:
+		return "PCS"
+	case SegmentTypeWds:
+		return "WDS"
+	case SegmentTypeEnd:
+		return "END"
+	}
+
+	return fmt.Sprintf("SegmentType(%d)", uint8(s))
+}
+
 type CompositionState uint8
 
 const (
@@ -23,12 +45,23 @@ const (
 	CompositionStateEpochStart
 )
 
+// PCS frame rate bytes
+const (
+	FrameRate23976 = 0x10
+	FrameRate24    = 0x20
+	FrameRate25    = 0x30
+	FrameRate2997  = 0x40
+	FrameRate50    = 0x60
+	FrameRate5994  = 0x70
+)
+
 type LastInSequenceFlag uint8
 
 const (
 	LastInSequenceFlagLastInSequence LastInSequenceFlag = iota
 	LastInSequenceFlagFirstInSequence
 	LastInSequenceFlagFirstAndLastInSequence
+	LastInSequenceFlagMiddleOfSequence
 )
 
 type SegmentHeader struct {
@@ -43,23 +76,29 @@ type Segment struct {
 	Header SegmentHeader
 }
 
-type PresentationCompositionSegment struct {
-	Width                            int
-	Height                           int
-	CompositionNumber                int
-	CompositionState                 CompositionState
-	PaletteUpdateFlag                bool
-	PaletteId                        int
-	CompositionObjectCount           int
+type CompositionObject struct {
 	ObjectId                         int
 	WindowId                         int
 	ObjectCroppedFlag                bool
+	ObjectForcedOnFlag               bool
 	ObjectHorizontalPosition         int
 	ObjectVerticalPosition           int
 	ObjectCroppingHorizontalPosition int
 	ObjectCroppingVerticalPosition   int
 	ObjectCroppingWidth              int
 	ObjectCroppingHeight             int
+}
+
+type PresentationCompositionSegment struct {
+	Width                  int
+	Height                 int
+	FrameRate              int
+	CompositionNumber      int
+	CompositionState       CompositionState
+	PaletteUpdateFlag      bool
+	PaletteId              int
+	CompositionObjectCount int
+	CompositionObjects     []CompositionObject
 
 	Segment
 }
@@ -0,0 +1,436 @@
+package ts
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// PgsStreamType Stream type of the PGS elementary streams in a program map table
+const PgsStreamType = 0x90
+
+const (
+	syncByte         = 0x47
+	tsPacketSize     = 188
+	m2tsPacketSize   = 192
+	patPid           = 0x0000
+	patTableId       = 0x00
+	pmtTableId       = 0x02
+	languageTag      = 0x0A
+	maxSectionLength = 1021
+)
+
+// DetectionHeaderLength Number of bytes needed by DetectPacketSize
+const DetectionHeaderLength = 2*m2tsPacketSize + m2tsPacketSize - tsPacketSize + 1
+
+// Stream PGS elementary stream of a transport stream
+type Stream struct {
+	Pid        int
+	StreamType int
+	// Language ISO 639-2 code of the stream, empty when the program map table doesn't describe it
+	Language string
+}
+
+// Pes Packetized elementary stream packet, with its timestamps in 90kHz units. The DTS is 0 when absent
+type Pes struct {
+	Pid                   int
+	PresentationTimestamp int64
+	DecodingTimestamp     int64
+	Data                  []byte
+}
+
+type Demuxer interface {
+	// Streams Read packets until every program map table is found and return the PGS streams sorted by PID
+	Streams() ([]Stream, error)
+
+	// NextPes Return the next complete PES packet of the given PID, or io.EOF once the stream is exhausted
+	NextPes(pid int) (*Pes, error)
+}
+
+type demuxer struct {
+	reader        *bufio.Reader
+	packetSize    int
+	sections      map[int][]byte
+	pmtPids       map[int]bool
+	streams       map[int]Stream
+	payloads      map[int][]byte
+	pendingPes    []Pes
+	programsFound bool
+	eof           bool
+}
+
+// NewDemuxer Initialize a new demuxer reading MPEG-2 transport streams with 188 bytes packets or Blu-ray M2TS streams
+// with 192 bytes packets, which are detected from the sync bytes
+func NewDemuxer(reader io.Reader) Demuxer {
+	return &demuxer{
+		reader:   bufio.NewReaderSize(reader, 64*1024),
+		sections: map[int][]byte{},
+		pmtPids:  map[int]bool{},
+		streams:  map[int]Stream{},
+		payloads: map[int][]byte{},
+	}
+}
+
+// DetectPacketSize Size of the packets of a stream starting with the given bytes, 0 when it's not a transport stream.
+// The header must hold the first bytes of 3 packets, see DetectionHeaderLength
+func DetectPacketSize(header []byte) int {
+	for _, packetSize := range []int{tsPacketSize, m2tsPacketSize} {
+		offset := packetSize - tsPacketSize
+
+		if len(header) > offset+2*packetSize &&
+			header[offset] == syncByte && header[offset+packetSize] == syncByte && header[offset+2*packetSize] == syncByte {
+			return packetSize
+		}
+	}
+
+	return 0
+}
+
+func (d *demuxer) Streams() ([]Stream, error) {
+	for !d.programsFound {
+		err := d.readPacket(-1)
+
+		if err == io.EOF {
+			return nil, errors.New("no program map table found")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var streams []Stream
+
+	for _, stream := range d.streams {
+		if stream.StreamType == PgsStreamType {
+			streams = append(streams, stream)
+		}
+	}
+
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].Pid < streams[j].Pid
+	})
+
+	return streams, nil
+}
+
+func (d *demuxer) NextPes(pid int) (*Pes, error) {
+	for len(d.pendingPes) == 0 {
+		if d.eof {
+			return nil, io.EOF
+		}
+
+		err := d.readPacket(pid)
+
+		if err == io.EOF {
+			// The last PES packet of the stream isn't followed by a payload unit start
+			d.eof = true
+			err = d.flushPes(pid)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pes := d.pendingPes[0]
+	d.pendingPes = d.pendingPes[1:]
+
+	return &pes, nil
+}
+
+// readPacket Read the next packet, parsing program tables and reassembling the PES packets of the given PID
+func (d *demuxer) readPacket(pid int) error {
+	if d.packetSize == 0 {
+		header, err := d.reader.Peek(DetectionHeaderLength)
+
+		if err != nil && len(header) == 0 {
+			return err
+		}
+
+		d.packetSize = DetectPacketSize(header)
+
+		if d.packetSize == 0 {
+			return errors.New("not a transport stream: sync byte not found")
+		}
+	}
+
+	packet := make([]byte, d.packetSize)
+
+	_, err := io.ReadFull(d.reader, packet)
+
+	if err == io.ErrUnexpectedEOF {
+		// Trailing bytes of an incomplete packet are ignored
+		return io.EOF
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// M2TS packets are prefixed with a 4 bytes arrival timestamp
+	packet = packet[d.packetSize-tsPacketSize:]
+
+	if packet[0] != syncByte {
+		return fmt.Errorf("sync byte not found, got %x", packet[0])
+	}
+
+	packetPid := int(packet[1]&0x1F)<<8 | int(packet[2])
+	payloadUnitStart := packet[1]&0x40 != 0
+	adaptationFieldControl := packet[3] >> 4 & 0x03
+
+	if packet[1]&0x80 != 0 || adaptationFieldControl&0x01 == 0 {
+		// Corrupted packets and packets without payload are skipped
+		return nil
+	}
+
+	payload := packet[4:]
+
+	if adaptationFieldControl&0x02 != 0 {
+		adaptationFieldLength := int(payload[0])
+
+		if adaptationFieldLength+1 > len(payload) {
+			return fmt.Errorf("invalid adaptation field length %d on PID %x", adaptationFieldLength, packetPid)
+		}
+
+		payload = payload[1+adaptationFieldLength:]
+	}
+
+	if _, ok := d.pmtPids[packetPid]; ok || packetPid == patPid {
+		return d.readSection(packetPid, payloadUnitStart, payload)
+	}
+
+	if packetPid != pid {
+		return nil
+	}
+
+	if payloadUnitStart {
+		err = d.flushPes(pid)
+
+		if err != nil {
+			return err
+		}
+
+		d.payloads[pid] = []byte{}
+	} else if _, ok := d.payloads[pid]; !ok {
+		// Continuation of a PES packet whose start was missed
+		return nil
+	}
+
+	d.payloads[pid] = append(d.payloads[pid], payload...)
+
+	return d.flushCompletePes(pid)
+}
+
+// readSection Accumulate the payloads of a PSI section and parse it once complete
+func (d *demuxer) readSection(pid int, payloadUnitStart bool, payload []byte) error {
+	if payloadUnitStart {
+		if len(payload) == 0 || int(payload[0])+1 > len(payload) {
+			return fmt.Errorf("invalid pointer field on PID %x", pid)
+		}
+
+		d.sections[pid] = append([]byte(nil), payload[1+int(payload[0]):]...)
+	} else if _, ok := d.sections[pid]; ok {
+		d.sections[pid] = append(d.sections[pid], payload...)
+	} else {
+		return nil
+	}
+
+	section := d.sections[pid]
+
+	if len(section) < 3 {
+		return nil
+	}
+
+	if section[0] == 0xFF {
+		// Stuffing
+		delete(d.sections, pid)
+		return nil
+	}
+
+	sectionLength := int(section[1]&0x0F)<<8 | int(section[2])
+
+	if sectionLength < 4 || sectionLength > maxSectionLength {
+		return fmt.Errorf("invalid section length %d on PID %x", sectionLength, pid)
+	}
+
+	if len(section) < 3+sectionLength {
+		return nil
+	}
+
+	delete(d.sections, pid)
+
+	// The 4 last bytes are the CRC
+	section = section[:3+sectionLength-4]
+
+	switch section[0] {
+	case patTableId:
+		return d.parsePat(section)
+	case pmtTableId:
+		return d.parsePmt(pid, section)
+	}
+
+	return nil
+}
+
+func (d *demuxer) parsePat(section []byte) error {
+	if len(section) < 8 {
+		return errors.New("program association table is too short")
+	}
+
+	for entry := section[8:]; len(entry) >= 4; entry = entry[4:] {
+		programNumber := int(entry[0])<<8 | int(entry[1])
+
+		if programNumber == 0 {
+			// Network information table
+			continue
+		}
+
+		pmtPid := int(entry[2]&0x1F)<<8 | int(entry[3])
+
+		// The table is repeated along the stream
+		if _, ok := d.pmtPids[pmtPid]; !ok {
+			d.pmtPids[pmtPid] = false
+		}
+	}
+
+	return nil
+}
+
+func (d *demuxer) parsePmt(pid int, section []byte) error {
+	if len(section) < 12 {
+		return fmt.Errorf("program map table on PID %x is too short", pid)
+	}
+
+	programInfoLength := int(section[10]&0x0F)<<8 | int(section[11])
+
+	if 12+programInfoLength > len(section) {
+		return fmt.Errorf("invalid program info length %d on PID %x", programInfoLength, pid)
+	}
+
+	entries := section[12+programInfoLength:]
+
+	for len(entries) >= 5 {
+		streamType := int(entries[0])
+		streamPid := int(entries[1]&0x1F)<<8 | int(entries[2])
+		infoLength := int(entries[3]&0x0F)<<8 | int(entries[4])
+
+		if 5+infoLength > len(entries) {
+			return fmt.Errorf("invalid elementary stream info length %d on PID %x", infoLength, pid)
+		}
+
+		d.streams[streamPid] = Stream{
+			Pid:        streamPid,
+			StreamType: streamType,
+			Language:   parseLanguage(entries[5 : 5+infoLength]),
+		}
+
+		entries = entries[5+infoLength:]
+	}
+
+	d.pmtPids[pid] = true
+	d.programsFound = true
+
+	for _, found := range d.pmtPids {
+		d.programsFound = d.programsFound && found
+	}
+
+	return nil
+}
+
+// flushCompletePes Queue the PES packet of the PID if its length is known and all its bytes were read
+func (d *demuxer) flushCompletePes(pid int) error {
+	payload := d.payloads[pid]
+
+	if len(payload) < 6 {
+		return nil
+	}
+
+	pesPacketLength := int(payload[4])<<8 | int(payload[5])
+
+	if pesPacketLength == 0 || len(payload) < 6+pesPacketLength {
+		return nil
+	}
+
+	d.payloads[pid] = payload[:6+pesPacketLength]
+
+	return d.flushPes(pid)
+}
+
+// flushPes Queue the PES packet being reassembled for the PID
+func (d *demuxer) flushPes(pid int) error {
+	payload, ok := d.payloads[pid]
+
+	if !ok {
+		return nil
+	}
+
+	delete(d.payloads, pid)
+
+	pes, err := parsePes(pid, payload)
+
+	if err != nil {
+		return err
+	}
+
+	d.pendingPes = append(d.pendingPes, *pes)
+
+	return nil
+}
+
+func parsePes(pid int, payload []byte) (*Pes, error) {
+	if len(payload) < 9 || !bytes.Equal(payload[:3], []byte{0x00, 0x00, 0x01}) {
+		return nil, fmt.Errorf("invalid PES packet on PID %x", pid)
+	}
+
+	ptsDtsFlags := payload[7] >> 6
+	headerDataLength := int(payload[8])
+
+	if 9+headerDataLength > len(payload) {
+		return nil, fmt.Errorf("invalid PES header length %d on PID %x", headerDataLength, pid)
+	}
+
+	header := payload[9 : 9+headerDataLength]
+	pes := &Pes{
+		Pid:  pid,
+		Data: payload[9+headerDataLength:],
+	}
+
+	if ptsDtsFlags&0x02 != 0 && len(header) >= 5 {
+		pes.PresentationTimestamp = parseTimestamp(header)
+	}
+
+	if ptsDtsFlags == 0x03 && len(header) >= 10 {
+		pes.DecodingTimestamp = parseTimestamp(header[5:])
+	}
+
+	return pes, nil
+}
+
+// parseTimestamp Decode a 33 bits timestamp split over 5 bytes with marker bits
+func parseTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+// parseLanguage Find the ISO 639 language descriptor of an elementary stream
+func parseLanguage(descriptors []byte) string {
+	for len(descriptors) >= 2 {
+		tag := descriptors[0]
+		length := int(descriptors[1])
+
+		if 2+length > len(descriptors) {
+			return ""
+		}
+
+		if tag == languageTag && length >= 3 {
+			return string(descriptors[2:5])
+		}
+
+		descriptors = descriptors[2+length:]
+	}
+
+	return ""
+}
@@ -0,0 +1,264 @@
+package ts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+const (
+	testPmtPid   = 0x0100
+	testVideoPid = 0x1011
+	testPgsPid   = 0x1200
+	testPgsPid2  = 0x1201
+)
+
+// testMuxer Writes transport stream packets of the given size
+type testMuxer struct {
+	packetSize int
+	data       []byte
+}
+
+// writePacket Write a packet carrying the payload, stuffed with an adaptation field when shorter than a packet
+func (m *testMuxer) writePacket(pid int, payloadUnitStart bool, payload []byte) {
+	if m.packetSize == m2tsPacketSize {
+		// Arrival timestamp
+		m.data = append(m.data, 0x12, 0x34, 0x56, 0x78)
+	}
+
+	header := []byte{syncByte, byte(pid >> 8 & 0x1F), byte(pid), 0x10}
+
+	if payloadUnitStart {
+		header[1] |= 0x40
+	}
+
+	if stuffing := tsPacketSize - 4 - len(payload); stuffing > 0 {
+		header[3] = 0x30
+		header = append(header, byte(stuffing-1))
+
+		if stuffing > 1 {
+			header = append(header, 0x00)
+			header = append(header, bytes.Repeat([]byte{0xFF}, stuffing-2)...)
+		}
+	}
+
+	m.data = append(m.data, header...)
+	m.data = append(m.data, payload...)
+}
+
+// writeSection Write a PSI section with a dummy CRC in a single packet
+func (m *testMuxer) writeSection(pid int, tableId byte, body []byte) {
+	sectionLength := len(body) + 4
+	section := []byte{0, tableId, 0xB0 | byte(sectionLength>>8), byte(sectionLength)}
+	section = append(section, body...)
+	section = append(section, 0xDE, 0xAD, 0xBE, 0xEF)
+
+	m.writePacket(pid, true, section)
+}
+
+func (m *testMuxer) writePat() {
+	m.writeSection(patPid, patTableId, []byte{0, 1, 0xC1, 0, 0, 0, 1, 0xE0 | testPmtPid>>8, testPmtPid & 0xFF})
+}
+
+func (m *testMuxer) writePmt() {
+	body := []byte{0, 1, 0xC1, 0, 0, 0xE0 | testVideoPid>>8, testVideoPid & 0xFF, 0xF0, 0}
+	body = append(body, 0x1B, 0xE0|testVideoPid>>8, testVideoPid&0xFF, 0xF0, 0)
+	body = append(body, PgsStreamType, 0xE0|testPgsPid2>>8, testPgsPid2&0xFF, 0xF0, 6, languageTag, 4, 'f', 'r', 'a', 0)
+	body = append(body, PgsStreamType, 0xE0|testPgsPid>>8, testPgsPid&0xFF, 0xF0, 6, languageTag, 4, 'e', 'n', 'g', 0)
+
+	m.writeSection(testPmtPid, pmtTableId, body)
+}
+
+// pesPacket PES packet of a private stream, with a DTS if it's not 0
+func pesPacket(presentationTimestamp int64, decodingTimestamp int64, data []byte) []byte {
+	flags := byte(0x80)
+	header := encodeTimestamp(0x2, presentationTimestamp)
+
+	if decodingTimestamp != 0 {
+		flags = 0xC0
+		header = encodeTimestamp(0x3, presentationTimestamp)
+		header = append(header, encodeTimestamp(0x1, decodingTimestamp)...)
+	}
+
+	length := 3 + len(header) + len(data)
+	pes := []byte{0, 0, 1, 0xBD, byte(length >> 8), byte(length), 0x81, flags, byte(len(header))}
+	pes = append(pes, header...)
+
+	return append(pes, data...)
+}
+
+// encodeTimestamp Encode a 33 bits timestamp over 5 bytes with marker bits
+func encodeTimestamp(prefix byte, timestamp int64) []byte {
+	return []byte{
+		prefix<<4 | byte(timestamp>>29)&0x0E | 1,
+		byte(timestamp >> 22),
+		byte(timestamp>>14)&0xFE | 1,
+		byte(timestamp >> 7),
+		byte(timestamp<<1) | 1,
+	}
+}
+
+// writePes Split the PES packet over as many packets as needed
+func (m *testMuxer) writePes(pid int, pes []byte) {
+	for start := true; len(pes) > 0; start = false {
+		size := len(pes)
+
+		if size > tsPacketSize-4 {
+			size = tsPacketSize - 4
+		}
+
+		m.writePacket(pid, start, pes[:size])
+		pes = pes[size:]
+	}
+}
+
+func testData(length int, seed byte) []byte {
+	data := make([]byte, length)
+
+	for i := range data {
+		data[i] = seed + byte(i*7)
+	}
+
+	return data
+}
+
+// testStream Transport stream with two PGS streams, the first packets of the PES packets of PID testPgsPid being
+// interleaved with the ones of testPgsPid2
+func testStream(packetSize int) []byte {
+	muxer := &testMuxer{packetSize: packetSize}
+	muxer.writePat()
+	muxer.writePmt()
+
+	first := pesPacket(0x123456789, 0x123450000, testData(500, 1))
+	other := pesPacket(1000, 0, testData(300, 2))
+
+	muxer.writePacket(testPgsPid, true, first[:184])
+	muxer.writePacket(testPgsPid2, true, other[:184])
+	muxer.writePacket(testPgsPid, false, first[184:368])
+	muxer.writePacket(testVideoPid, true, testData(184, 3))
+	muxer.writePacket(testPgsPid2, false, other[184:])
+	muxer.writePacket(testPgsPid, false, first[368:])
+	muxer.writePes(testPgsPid, pesPacket(90000, 0, testData(20, 4)))
+
+	return muxer.data
+}
+
+func TestDetectPacketSize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected int
+	}{
+		{name: "transport stream", data: testStream(tsPacketSize), expected: tsPacketSize},
+		{name: "M2TS", data: testStream(m2tsPacketSize), expected: m2tsPacketSize},
+		{name: "SUP", data: append([]byte{'P', 'G'}, make([]byte, DetectionHeaderLength)...), expected: 0},
+		{name: "too short", data: testStream(tsPacketSize)[:2*tsPacketSize], expected: 0},
+	}
+
+	for _, testCase := range testCases {
+		header := testCase.data
+
+		if len(header) > DetectionHeaderLength {
+			header = header[:DetectionHeaderLength]
+		}
+
+		if got := DetectPacketSize(header); got != testCase.expected {
+			t.Fatalf("%s: expected packet size %d, got %d", testCase.name, testCase.expected, got)
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	for _, packetSize := range []int{tsPacketSize, m2tsPacketSize} {
+		streams, err := NewDemuxer(bytes.NewReader(testStream(packetSize))).Streams()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Stream{
+			{Pid: testPgsPid, StreamType: PgsStreamType, Language: "eng"},
+			{Pid: testPgsPid2, StreamType: PgsStreamType, Language: "fra"},
+		}
+
+		if len(streams) != len(expected) {
+			t.Fatalf("%d bytes packets: expected streams %v, got %v", packetSize, expected, streams)
+		}
+
+		for i := range expected {
+			if streams[i] != expected[i] {
+				t.Fatalf("%d bytes packets: expected streams %v, got %v", packetSize, expected, streams)
+			}
+		}
+	}
+}
+
+func TestNextPes(t *testing.T) {
+	for _, packetSize := range []int{tsPacketSize, m2tsPacketSize} {
+		testCases := []struct {
+			pid      int
+			expected []Pes
+		}{
+			{
+				pid: testPgsPid,
+				expected: []Pes{
+					{Pid: testPgsPid, PresentationTimestamp: 0x123456789, DecodingTimestamp: 0x123450000, Data: testData(500, 1)},
+					{Pid: testPgsPid, PresentationTimestamp: 90000, Data: testData(20, 4)},
+				},
+			},
+			{
+				pid: testPgsPid2,
+				expected: []Pes{
+					{Pid: testPgsPid2, PresentationTimestamp: 1000, Data: testData(300, 2)},
+				},
+			},
+		}
+
+		for _, testCase := range testCases {
+			demuxer := NewDemuxer(bytes.NewReader(testStream(packetSize)))
+
+			for i, expected := range testCase.expected {
+				pes, err := demuxer.NextPes(testCase.pid)
+
+				if err != nil {
+					t.Fatalf("%d bytes packets, PID %x: %v", packetSize, testCase.pid, err)
+				}
+
+				if pes.Pid != expected.Pid || pes.PresentationTimestamp != expected.PresentationTimestamp ||
+					pes.DecodingTimestamp != expected.DecodingTimestamp || !bytes.Equal(pes.Data, expected.Data) {
+					t.Fatalf("%d bytes packets, PID %x: PES %d has PTS %x, DTS %x and %d bytes, expected PTS %x, DTS %x and %d bytes",
+						packetSize, testCase.pid, i, pes.PresentationTimestamp, pes.DecodingTimestamp, len(pes.Data),
+						expected.PresentationTimestamp, expected.DecodingTimestamp, len(expected.Data))
+				}
+			}
+
+			if _, err := demuxer.NextPes(testCase.pid); err != io.EOF {
+				t.Fatalf("%d bytes packets, PID %x: expected io.EOF, got %v", packetSize, testCase.pid, err)
+			}
+		}
+	}
+}
+
+func TestSupReader(t *testing.T) {
+	segments := []byte{0x16, 0, 2, 0xAA, 0xBB, 0x80, 0, 0}
+	muxer := &testMuxer{packetSize: tsPacketSize}
+	muxer.writePat()
+	muxer.writePmt()
+	muxer.writePes(testPgsPid, pesPacket(0x123456789, 0x100000000, segments))
+
+	sup, err := io.ReadAll(NewSupReader(NewDemuxer(bytes.NewReader(muxer.data)), testPgsPid))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The 33rd bit of the timestamps doesn't fit in a SUP header
+	expected := []byte{
+		'P', 'G', 0x23, 0x45, 0x67, 0x89, 0, 0, 0, 0, 0x16, 0, 2, 0xAA, 0xBB,
+		'P', 'G', 0x23, 0x45, 0x67, 0x89, 0, 0, 0, 0, 0x80, 0, 0,
+	}
+
+	if !bytes.Equal(sup, expected) {
+		t.Fatalf("expected SUP stream %x, got %x", expected, sup)
+	}
+}
@@ -0,0 +1,75 @@
+package ts
+
+import (
+	"fmt"
+	"github.com/mbiamont/go-pgs-parser/buffer"
+	"github.com/mbiamont/go-pgs-parser/segment"
+	"io"
+)
+
+// maxTimestamp SUP timestamps are 32 bits long while PES ones are 33 bits long
+const maxTimestamp = 1<<32 - 1
+
+type supReader struct {
+	demuxer Demuxer
+	pid     int
+	pending []byte
+}
+
+// NewSupReader Read a PGS stream as a SUP stream, each segment of a PES packet being prefixed with a header holding
+// the PTS and DTS of the packet
+func NewSupReader(demuxer Demuxer, pid int) io.Reader {
+	return &supReader{
+		demuxer: demuxer,
+		pid:     pid,
+	}
+}
+
+func (s *supReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		pes, err := s.demuxer.NextPes(s.pid)
+
+		if err != nil {
+			return 0, err
+		}
+
+		s.pending, err = s.toSup(*pes)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+
+	return n, nil
+}
+
+// toSup Prefix each segment of the PES packet with a SUP segment header
+func (s *supReader) toSup(pes Pes) ([]byte, error) {
+	writer := buffer.NewBufferWriter()
+	data := pes.Data
+
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("truncated segment in PES packet with PTS %d", pes.PresentationTimestamp)
+		}
+
+		size := 3 + (int(data[1])<<8 | int(data[2]))
+
+		if len(data) < size {
+			return nil, fmt.Errorf("truncated segment in PES packet with PTS %d", pes.PresentationTimestamp)
+		}
+
+		writer.WriteBytes(segment.PgMagicNumber, 2)
+		writer.WriteBytes(int(pes.PresentationTimestamp&maxTimestamp), 4)
+		writer.WriteBytes(int(pes.DecodingTimestamp&maxTimestamp), 4)
+
+		writer.WriteByteSlice(data[:size])
+
+		data = data[size:]
+	}
+
+	return writer.Bytes(), nil
+}